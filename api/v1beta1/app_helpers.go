@@ -1 +1,110 @@
 package v1beta1
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+const (
+	// ReconciledReason is used when an App has been rendered and applied successfully
+	ReconciledReason = "Reconciled"
+	// ReconcileFailedReason is used when rendering or applying an App failed
+	ReconcileFailedReason = "ReconcileFailed"
+	// AppOutputNotReadyReason is used when an App consumes an output another App did not publish yet
+	AppOutputNotReadyReason = "AppOutputNotReady"
+	// OutputNotAvailableReason is used when an App could not read one of its own outputs yet
+	OutputNotAvailableReason = "OutputNotAvailable"
+	// DependencyNotReadyReason is used when a CapDep the Cap of an App depends on does not exist (yet)
+	DependencyNotReadyReason = "DependencyNotReady"
+	// AppSuspendedReason is used when the App itself is suspended
+	AppSuspendedReason = "AppSuspended"
+	// CapSuspendedReason is used when the Cap of an App is suspended
+	CapSuspendedReason = "CapSuspended"
+	// ResumedReason is used when a previously suspended App is reconciled again
+	ResumedReason = "Resumed"
+)
+
+// SuspendAnnotation suspends an App or Cap when set to "true", just like their suspend field
+const SuspendAnnotation = "shipcaps.redradrat.xyz/suspend"
+
+// IsSuspended returns true if the App is suspended via its spec or annotation
+func (app *App) IsSuspended() bool {
+	return app.Spec.Suspend || app.Annotations[SuspendAnnotation] == "true"
+}
+
+// ReferencesValueSource returns true if any of the App's values reads from the named Secret (or ConfigMap, if secret
+// is false)
+func (app *App) ReferencesValueSource(name string, secret bool) bool {
+	avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
+	if err != nil {
+		return false
+	}
+	return avs.ReferencesValueSource(name, secret)
+}
+
+// ReferencesAppOutput returns true if any of the App's values consumes an output of the named App
+func (app *App) ReferencesAppOutput(name string) bool {
+	avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
+	if err != nil {
+		return false
+	}
+	return avs.ReferencesApp(name)
+}
+
+// GetTargetNamespace returns the namespace the App renders namespaced objects into, if they don't specify one
+func (app *App) GetTargetNamespace() string {
+	if app.Spec.TargetNamespace == "" {
+		return app.Namespace
+	}
+	return app.Spec.TargetNamespace
+}
+
+// DefaultRevisionHistoryLimit is the number of revisions kept, if an App doesn't specify it
+const DefaultRevisionHistoryLimit = 10
+
+// GetRevisionHistoryLimit returns the number of revisions to keep for the App
+func (app *App) GetRevisionHistoryLimit() int {
+	if app.Spec.RevisionHistoryLimit == nil {
+		return DefaultRevisionHistoryLimit
+	}
+	return int(*app.Spec.RevisionHistoryLimit)
+}
+
+// RevisionSecretName returns the name of the Secret holding the given revision of the App
+func (app *App) RevisionSecretName(revision int64) string {
+	return fmt.Sprintf("%s-rev-%d", app.Name, revision)
+}
+
+// OutputsSecretName returns the name of the Secret the App publishes its outputs into
+func (app *App) OutputsSecretName() string {
+	return app.Name + "-outputs"
+}
+
+// GetCondition returns the condition of the given type, or nil if the App does not have it
+func (app *App) GetCondition(t AppConditionType) *AppCondition {
+	for i := range app.Status.Conditions {
+		if app.Status.Conditions[i].Type == t {
+			return &app.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition sets the condition of the given type. The transition time is only updated if the status changes.
+func (app *App) SetCondition(t AppConditionType, status v1.ConditionStatus, reason, message string) {
+	cond := app.GetCondition(t)
+	if cond == nil {
+		app.Status.Conditions = append(app.Status.Conditions, AppCondition{Type: t})
+		cond = &app.Status.Conditions[len(app.Status.Conditions)-1]
+	}
+	if cond.Status != status {
+		cond.Status = status
+		cond.LastTransitionTime = metav1.Now()
+	}
+	cond.Reason = reason
+	cond.Message = message
+}
@@ -41,6 +41,139 @@ type AppSpec struct {
 	//
 	// +kubebuilder:validation:Optional
 	Values json.RawMessage `json:"values,omitempty"`
+
+	// PublishOutputsSecret makes the App publish all its outputs into a generated Secret. Apps with sensitive outputs
+	// always publish this Secret.
+	//
+	// +kubebuilder:validation:Optional
+	PublishOutputsSecret bool `json:"publishOutputsSecret,omitempty"`
+
+	// DriftPolicy specifies how out-of-band changes to the objects of this App are handled. Overrides the policy of
+	// the Cap.
+	//
+	// +kubebuilder:validation:Optional
+	DriftPolicy *DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Suspend stops the App from being rendered and applied, until it is set to false again. The status is still
+	// reported.
+	//
+	// +kubebuilder:validation:Optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Revision pins the App to a previous revision. The exact objects rendered for that revision are applied again,
+	// regardless of changes to the Cap or values. Unset to follow the Cap again.
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	Revision *int64 `json:"revision,omitempty"`
+
+	// RevisionHistoryLimit is the number of revisions kept for rollback. Defaults to 10.
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// CapVersion pins the App to a version of its Cap. Either an exact version, or a range like "~1.2" or
+	// ">= 1.0.0, < 2.0.0". The App uses the latest Cap revision with a matching version.
+	//
+	// +kubebuilder:validation:Optional
+	CapVersion string `json:"capVersion,omitempty"`
+
+	// TargetNamespace is the namespace namespaced objects that don't specify one are rendered into, and the target
+	// namespace of the HelmRelease. Defaults to the namespace of the App. Must be allowed by the namespace policy.
+	//
+	// +kubebuilder:validation:Optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// ServiceAccountName is the name of a ServiceAccount in the App's namespace, that the rendered objects are
+	// applied as. Overrides the ServiceAccount of the Cap. The operator's own identity is used if neither is set.
+	//
+	// +kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// AppConditionType is a valid value for AppCondition.Type
+type AppConditionType string
+
+const (
+	// AppReady means the App has been rendered and applied, and all of its outputs are available
+	AppReady AppConditionType = "Ready"
+	// AppSuspended means the App, or the Cap it uses, is suspended and will not be rendered and applied
+	AppSuspended AppConditionType = "Suspended"
+)
+
+// AppCondition describes the state of an App at a certain point
+type AppCondition struct {
+	// Type of the condition
+	Type AppConditionType `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown
+	Status v1.ConditionStatus `json:"status"`
+
+	// Reason is a machine-readable explanation for the condition's last transition
+	//
+	// +kubebuilder:validation:Optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human-readable explanation for the condition's last transition
+	//
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is the last time the condition changed its status
+	//
+	// +kubebuilder:validation:Optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// AppObjectConflict describes an applied object, of which some fields are managed by another field manager
+type AppObjectConflict struct {
+	// APIVersion of the object
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object
+	Kind string `json:"kind"`
+
+	// Namespace of the object
+	//
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the object
+	Name string `json:"name"`
+
+	// Fields that are managed by another field manager, and were therefore not applied
+	//
+	// +kubebuilder:validation:Optional
+	Fields []string `json:"fields,omitempty"`
+
+	// Message describes the conflict
+	//
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// AppObjectDrift describes an applied object, of which some fields were changed out-of-band
+type AppObjectDrift struct {
+	// APIVersion of the object
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object
+	Kind string `json:"kind"`
+
+	// Namespace of the object
+	//
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the object
+	Name string `json:"name"`
+
+	// Fields that differ from their rendered values
+	Fields []string `json:"fields"`
+
+	// Corrected is true if the fields were reverted to their rendered values
+	Corrected bool `json:"corrected"`
 }
 
 // AppStatus defines the observed state of App
@@ -49,9 +182,79 @@ type AppStatus struct {
 	//
 	// ObservedGeneration holds the generation (metadata.generation in CR) observed by the controller
 	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// Conditions describe the current state of the App
+	//
+	// +kubebuilder:validation:Optional
+	Conditions []AppCondition `json:"conditions,omitempty"`
+
+	// Outputs holds the non-sensitive outputs published by this App
+	//
+	// +kubebuilder:validation:Optional
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// OutputsSecretName is the name of the generated Secret holding all outputs of this App
+	//
+	// +kubebuilder:validation:Optional
+	OutputsSecretName string `json:"outputsSecretName,omitempty"`
+
+	// Conflicts lists all applied objects with fields managed by another field manager
+	//
+	// +kubebuilder:validation:Optional
+	Conflicts []AppObjectConflict `json:"conflicts,omitempty"`
+
+	// Drift lists all applied objects that were changed out-of-band
+	//
+	// +kubebuilder:validation:Optional
+	Drift []AppObjectDrift `json:"drift,omitempty"`
+
+	// Revision is the revision currently applied
+	//
+	// +kubebuilder:validation:Optional
+	Revision int64 `json:"revision,omitempty"`
+
+	// History lists all revisions kept for rollback, oldest first
+	//
+	// +kubebuilder:validation:Optional
+	History []AppRevision `json:"history,omitempty"`
+
+	// CapRevision is the revision of the Cap the App was last rendered from
+	//
+	// +kubebuilder:validation:Optional
+	CapRevision int64 `json:"capRevision,omitempty"`
+
+	// CapVersion is the version of the Cap the App was last rendered from
+	//
+	// +kubebuilder:validation:Optional
+	CapVersion string `json:"capVersion,omitempty"`
+
+	// Usage is the sum of the CPU, memory and storage requested by the workloads and PersistentVolumeClaims the App
+	// rendered. Charts installed by a HelmRelease are not accounted, so the usage of Apps of helmchart Caps is empty.
+	//
+	// +kubebuilder:validation:Optional
+	Usage v1.ResourceList `json:"usage,omitempty"`
+}
+
+// AppRevision describes a stored revision of an App
+type AppRevision struct {
+	// Revision is the number of this revision
+	Revision int64 `json:"revision"`
+
+	// CapGeneration is the generation of the Cap this revision was rendered from
+	CapGeneration int64 `json:"capGeneration"`
+
+	// Hash is the hash of the rendered revision
+	Hash string `json:"hash"`
+
+	// SecretName is the name of the Secret holding the revision
+	SecretName string `json:"secretName"`
+
+	// Created is the time the revision was created
+	Created metav1.Time `json:"created"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // App is the Schema for the apps API
 type App struct {
@@ -11,47 +11,36 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-// RenderValues takes an App Object as input and uses its spec to render a complete set of CapValues
-func (cap *Cap) RenderValues(app *App) (parsing.CapValues, error) {
+// RenderValues takes an App Object as input and uses its spec to render a complete set of CapValues. Any valueFrom
+// references of the App and the Cap are looked up with the given resolver, which should be scoped to the App's
+// namespace.
+func (cap *Cap) RenderValues(app *App, resolver parsing.ValueFromResolver) (parsing.CapValues, error) {
 	var outList []parsing.CapValue
+	errCtx := errors.Context{App: app.AppKey(), Cap: cap.CapKey()}
 
 	// Unmarshal given App's values.
 	avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(errors.InvalidValuesCode, err, "invalid app values").With(errCtx)
+	}
+	// Resolve any values that reference Secrets or ConfigMaps
+	avs, err = avs.ResolveValueFrom(resolver)
+	if err != nil {
+		return nil, resolveError(err).With(errCtx)
 	}
 
 	// Go through the whole map and see if all Inputs are given, and have the right type.
 	avMap := avs.Map()
 	for _, in := range cap.Spec.Inputs {
-		var err bool
 		data, found := avMap[in.Key]
 		if !found {
 			if !in.Optional {
-				return nil, fmt.Errorf("required key '%s' not found in App values", in.Key)
+				return nil, missingInputError(in).With(errCtx)
 			}
 			continue
 		}
-		switch in.Type {
-		case StringInputType:
-			if _, ok := data.(string); !ok {
-				err = true
-			}
-		case StringListInputType:
-			if _, ok := data.([]string); !ok {
-				err = true
-			}
-		case IntInputType:
-			if _, ok := data.(int); !ok {
-				err = true
-			}
-		case FloatInputType:
-			if _, ok := data.(float32); !ok {
-				err = true
-			}
-		}
-		if err {
-			return nil, fmt.Errorf("required input '%s' is not of type '%s'", in.Key, in.Type)
+		if !in.Accepts(data) {
+			return nil, typeMismatchError(in).With(errCtx)
 		}
 		// Value looks good, let's put it onto our output slice.
 		outList = append(outList, parsing.CapValue{TargetIdentifier: in.TargetIdentifier, Value: data})
@@ -60,22 +49,128 @@ func (cap *Cap) RenderValues(app *App) (parsing.CapValues, error) {
 	// Unmarshal the Values from our Cap and put them onto the output slice
 	cvs, err := parsing.ParseRawCapValues(parsing.RawCapValues(cap.Spec.Values))
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(errors.InvalidValuesCode, err, "invalid cap values").With(errCtx)
+	}
+	cvs, err = cvs.ResolveValueFrom(resolver)
+	if err != nil {
+		return nil, resolveError(err).With(errCtx)
 	}
 	outList = append(outList, cvs...)
 
 	return outList, nil
 }
 
+// ValidateValues checks the values of the App against the inputs of the Cap, without looking up any references. All
+// required inputs have to be given, references have to be complete, and literal values have to be of the input's
+// type. Referenced values are checked once they are resolved by RenderValues.
+func (cap *Cap) ValidateValues(app *App) error {
+	errCtx := errors.Context{App: app.AppKey(), Cap: cap.CapKey()}
+
+	avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
+	if err != nil {
+		return errors.Wrap(errors.InvalidValuesCode, err, "invalid app values").With(errCtx)
+	}
+	if err := avs.CheckReferences(); err != nil {
+		return errors.Wrap(errors.InvalidValuesCode, err, "").With(errCtx)
+	}
+
+	given := make(map[string]parsing.AppValue, len(avs))
+	for _, v := range avs {
+		given[v.Key] = v
+	}
+	for _, in := range cap.Spec.Inputs {
+		v, found := given[in.Key]
+		if !found {
+			if !in.Optional {
+				return missingInputError(in).With(errCtx)
+			}
+			continue
+		}
+		if v.ValueFrom == nil && v.ValueFromApp == nil && !in.Accepts(v.Value) {
+			return typeMismatchError(in).With(errCtx)
+		}
+	}
+	return nil
+}
+
+// Accepts returns true if the given value, decoded from JSON, is of the input's type. Numbers are float64 and lists
+// []interface{}.
+func (in *CapInput) Accepts(data interface{}) bool {
+	switch in.Type {
+	case StringInputType:
+		_, ok := data.(string)
+		return ok
+	case StringListInputType:
+		return isStringList(data)
+	case IntInputType:
+		f, ok := data.(float64)
+		return ok && f == float64(int64(f))
+	case FloatInputType:
+		_, ok := data.(float64)
+		return ok
+	}
+	return true
+}
+
+func missingInputError(in CapInput) errors.ShipCapsError {
+	return errors.NewShipCapsError(errors.MissingInputCode, fmt.Sprintf("required key '%s' not found in App values", in.Key)).
+		With(errors.Context{Key: in.Key})
+}
+
+func typeMismatchError(in CapInput) errors.ShipCapsError {
+	return errors.NewShipCapsError(errors.TypeMismatchCode, fmt.Sprintf("required input '%s' is not of type '%s'", in.Key, in.Type)).
+		With(errors.Context{Key: in.Key})
+}
+
+// resolveError returns the error for values whose references could not be resolved. The resolver reports missing
+// Secrets, ConfigMaps and keys, or outputs not published yet, with a code. Other errors may resolve by themselves.
+func resolveError(err error) errors.ShipCapsError {
+	code, ok := errors.CodeOf(err)
+	if !ok {
+		code = errors.ValueResolutionFailedCode
+	}
+	return errors.Wrap(code, err, "")
+}
+
+// isStringList returns true if the given decoded value is a list of strings
+func isStringList(data interface{}) bool {
+	list, ok := data.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ReferencesValueSource returns true if any of the Cap's values reads from the named Secret (or ConfigMap, if secret
+// is false)
+func (cap *Cap) ReferencesValueSource(name string, secret bool) bool {
+	cvs, err := parsing.ParseRawCapValues(parsing.RawCapValues(cap.Spec.Values))
+	if err != nil {
+		return false
+	}
+	return cvs.ReferencesValueSource(name, secret)
+}
+
+// GetUnstructuredObjects renders the InLine manifests of the source with the given values
 func (source *CapSource) GetUnstructuredObjects(values parsing.CapValues) (unstructured.UnstructuredList, error) {
-	uList := unstructured.UnstructuredList{}
 	var parseMap []map[string]interface{}
 
 	if err := json.Unmarshal(source.InLine, &parseMap); err != nil {
-		return uList, err
+		return unstructured.UnstructuredList{}, err
 	}
 
-	for _, manifest := range parseMap {
+	return RenderManifests(parseMap, values)
+}
+
+// RenderManifests renders the given manifests with the given values
+func RenderManifests(manifests []map[string]interface{}, values parsing.CapValues) (unstructured.UnstructuredList, error) {
+	uList := unstructured.UnstructuredList{}
+	for _, manifest := range manifests {
 		unstruct := unstructured.Unstructured{}
 		unstructContent, err := ReplacePlaceholders(manifest, values)
 		if err != nil {
@@ -90,6 +185,11 @@ func (source *CapSource) GetUnstructuredObjects(values parsing.CapValues) (unstr
 
 // ReplacePlaceholder takes a map and replaces any found placeholder string values with arbitrary values
 func ReplacePlaceholders(in map[string]interface{}, vals parsing.CapValues) (map[string]interface{}, error) {
+	return replacePlaceholders(in, vals, "")
+}
+
+// replacePlaceholders replaces the placeholders of the map at the given JSON path
+func replacePlaceholders(in map[string]interface{}, vals parsing.CapValues, path string) (map[string]interface{}, error) {
 	out := make(map[string]interface{})
 	// Iterate through the whole map
 	for key, value := range in {
@@ -99,16 +199,27 @@ func ReplacePlaceholders(in map[string]interface{}, vals parsing.CapValues) (map
 			if id, ok := IsFullPlaceholder(typedval); ok {
 				// If our value is a placeholder string, then replace the whole value with what we get
 				// from our CapValues.
-				out[key] = vals.Map()[id]
+				value, found := vals.Map()[id]
+				if !found {
+					return out, errors.NewShipCapsError(errors.UnresolvedPlaceholderCode, fmt.Sprintf("placeholder '%s' at %s.%s references no value", id, path, key)).
+						With(errors.Context{Path: path + "." + key})
+				}
+				out[key] = value
 			} else if placeholders, ok := IsStringPlaceholders(typedval); ok {
 				// If our value is a string that contains multiple placeholders, then replace the subparts
 				// with what we get from our CapValues.
 				intstr := typedval
 				for _, placeholder := range placeholders {
 					id, _ := IsFullPlaceholder(placeholder)
-					targetval, ok := vals.Map()[id].(string)
+					value, found := vals.Map()[id]
+					if !found {
+						return out, errors.NewShipCapsError(errors.UnresolvedPlaceholderCode, fmt.Sprintf("placeholder '%s' at %s.%s references no value", id, path, key)).
+							With(errors.Context{Path: path + "." + key})
+					}
+					targetval, ok := value.(string)
 					if !ok {
-						return out, errors.NewShipCapsError(InvalidMaterialSpecCode, "non-string value used in in-line string replacement")
+						return out, errors.NewShipCapsError(errors.TypeMismatchCode, fmt.Sprintf("non-string value of '%s' used in in-line string replacement at %s.%s", id, path, key)).
+							With(errors.Context{Path: path + "." + key})
 					}
 					intstr = strings.ReplaceAll(intstr, placeholder, targetval)
 				}
@@ -119,7 +230,7 @@ func ReplacePlaceholders(in map[string]interface{}, vals parsing.CapValues) (map
 			}
 		case map[string]interface{}:
 			// If our value is another map[string]interface{}, then onwards into the rabbit hole.
-			intval, err := ReplacePlaceholders(typedval, vals)
+			intval, err := replacePlaceholders(typedval, vals, path+"."+key)
 			if err != nil {
 				return nil, err
 			}
@@ -190,9 +301,79 @@ func (source *CapSource) Check() error {
 	if source.IsInLine() && source.IsRepo() {
 		return errors.NewShipCapsError(InvalidMaterialSpecCode, "both inline and repo specified")
 	}
+	switch source.Type {
+	case SimpleCapSourceType:
+	case HelmChartCapSourceType:
+		if !source.IsRepo() {
+			return errors.NewShipCapsError(InvalidMaterialSpecCode, "helmchart sources require a repo")
+		}
+		// The helm-operator fetches charts itself, with the git credentials mounted into it. It can't read ours.
+		if source.Repo.Auth.IsSet() {
+			return errors.NewShipCapsError(InvalidMaterialSpecCode, "helmchart sources don't support repo auth, configure git credentials for the helm-operator instead")
+		}
+	default:
+		return errors.NewShipCapsError(InvalidMaterialSpecCode, fmt.Sprintf("unknown source type '%s'", source.Type))
+	}
 	return nil
 }
 
 const (
-	InvalidMaterialSpecCode errors.ShipCapsErrorCode = "InvalidMaterialSpec"
+	// InvalidMaterialSpecCode identifies errors caused by an invalid source
+	InvalidMaterialSpecCode = errors.InvalidMaterialSpecCode
 )
+
+// Matches returns true if the selector applies to the given object
+func (sel *FieldSelector) Matches(obj unstructured.Unstructured) bool {
+	return sel.Kind == obj.GetKind() && (sel.Name == "" || sel.Name == obj.GetName())
+}
+
+// Selects returns true if the given field path (e.g. ".spec.replicas") is selected by any of the selector's paths
+func (sel *FieldSelector) Selects(field string) bool {
+	field = "." + strings.TrimPrefix(field, ".")
+	for _, p := range sel.Paths {
+		p = "." + strings.Trim(p, ".")
+		if field == p || strings.HasPrefix(field, p+".") || strings.HasPrefix(field, p+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckServiceAccount returns an error if a ServiceAccount to apply the objects of the given App as is named for a
+// helmchart Cap. The helm-operator installs the charts with its own identity, so impersonation would be pointless.
+// The App may be nil to only check the Cap.
+func (cap *Cap) CheckServiceAccount(app *App) error {
+	if cap.Spec.Source.Type != HelmChartCapSourceType {
+		return nil
+	}
+	if cap.Spec.ServiceAccountName == "" && (app == nil || app.Spec.ServiceAccountName == "") {
+		return nil
+	}
+	err := errors.NewShipCapsError(errors.ImpersonationNotSupportedCode,
+		"serviceAccountName is not supported for helmchart caps, as the helm-operator installs their charts with its own identity").
+		With(errors.Context{Cap: cap.CapKey()})
+	if app != nil {
+		err = err.With(errors.Context{App: app.AppKey()})
+	}
+	return err
+}
+
+// IsSet returns true if any credentials are given
+func (auth *RepoAuth) IsSet() bool {
+	return auth.Username != nil || auth.Password != nil || auth.SSH != nil
+}
+
+// SelectsField returns true if any of the given selectors selects the field of the given object
+func SelectsField(selectors []FieldSelector, obj unstructured.Unstructured, field string) bool {
+	for _, sel := range selectors {
+		if sel.Matches(obj) && sel.Selects(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSuspended returns true if the Cap is suspended via its spec or annotation
+func (cap *Cap) IsSuspended() bool {
+	return cap.Spec.Suspend || cap.Annotations[SuspendAnnotation] == "true"
+}
@@ -0,0 +1,157 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redradrat/shipcaps/errors"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestRenderValuesTypes(t *testing.T) {
+	cap := &Cap{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: CapSpec{
+			Inputs: CapInputs{
+				{Key: "name", Type: StringInputType, TargetIdentifier: "name"},
+				{Key: "replicas", Type: IntInputType, TargetIdentifier: "replicas", Optional: true},
+				{Key: "ratio", Type: FloatInputType, TargetIdentifier: "ratio", Optional: true},
+				{Key: "hosts", Type: StringListInputType, TargetIdentifier: "hosts", Optional: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		values string
+		code   errors.ShipCapsErrorCode
+	}{
+		{name: "all types", values: `[{"key":"name","value":"web"},{"key":"replicas","value":3},{"key":"ratio","value":0.5},{"key":"hosts","value":["a","b"]}]`},
+		{name: "float for float input", values: `[{"key":"name","value":"web"},{"key":"ratio","value":1}]`},
+		{name: "empty string list", values: `[{"key":"name","value":"web"},{"key":"hosts","value":[]}]`},
+		{name: "missing required input", values: `[{"key":"replicas","value":3}]`, code: errors.MissingInputCode},
+		{name: "number for string input", values: `[{"key":"name","value":1}]`, code: errors.TypeMismatchCode},
+		{name: "fraction for int input", values: `[{"key":"name","value":"web"},{"key":"replicas","value":1.5}]`, code: errors.TypeMismatchCode},
+		{name: "string for int input", values: `[{"key":"name","value":"web"},{"key":"replicas","value":"3"}]`, code: errors.TypeMismatchCode},
+		{name: "string for float input", values: `[{"key":"name","value":"web"},{"key":"ratio","value":"0.5"}]`, code: errors.TypeMismatchCode},
+		{name: "numbers in string list", values: `[{"key":"name","value":"web"},{"key":"hosts","value":["a",1]}]`, code: errors.TypeMismatchCode},
+		{name: "string for string list", values: `[{"key":"name","value":"web"},{"key":"hosts","value":"a"}]`, code: errors.TypeMismatchCode},
+		{name: "malformed values", values: `{"name":"web"}`, code: errors.InvalidValuesCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       AppSpec{Values: json.RawMessage(tt.values)},
+			}
+			_, err := cap.RenderValues(app, nil)
+			code, _ := errors.CodeOf(err)
+			if code != tt.code {
+				t.Errorf("RenderValues() error = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestCheckServiceAccount(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    CapSourceType
+		capSA     string
+		appSA     string
+		supported bool
+	}{
+		{name: "simple cap", source: SimpleCapSourceType, capSA: "deployer", appSA: "deployer", supported: true},
+		{name: "helmchart cap without service account", source: HelmChartCapSourceType, supported: true},
+		{name: "helmchart cap with service account", source: HelmChartCapSourceType, capSA: "deployer"},
+		{name: "app of helmchart cap with service account", source: HelmChartCapSourceType, appSA: "deployer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cap := &Cap{Spec: CapSpec{Source: CapSource{Type: tt.source}, ServiceAccountName: tt.capSA}}
+			app := &App{Spec: AppSpec{ServiceAccountName: tt.appSA}}
+			err := cap.CheckServiceAccount(app)
+			if tt.supported != (err == nil) {
+				t.Errorf("CheckServiceAccount() = %v", err)
+			}
+			if err != nil && !errors.IsErr(err, errors.ImpersonationNotSupportedCode) {
+				t.Errorf("CheckServiceAccount() returned unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	vals := parsing.CapValues{
+		{TargetIdentifier: "name", Value: "web"},
+		{TargetIdentifier: "replicas", Value: float64(2)},
+		{TargetIdentifier: "unset", Value: nil},
+	}
+
+	tests := []struct {
+		name string
+		in   map[string]interface{}
+		want map[string]interface{}
+		code errors.ShipCapsErrorCode
+	}{
+		{
+			name: "full placeholder",
+			in:   map[string]interface{}{"spec": map[string]interface{}{"replicas": "{{ replicas }}"}},
+			want: map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(2)}},
+		},
+		{
+			name: "full placeholder of a null value",
+			in:   map[string]interface{}{"spec": map[string]interface{}{"replicas": "{{ unset }}"}},
+			want: map[string]interface{}{"spec": map[string]interface{}{"replicas": nil}},
+		},
+		{
+			name: "placeholders within a string",
+			in:   map[string]interface{}{"metadata": map[string]interface{}{"name": "{{ name }}-{{ name }}"}},
+			want: map[string]interface{}{"metadata": map[string]interface{}{"name": "web-web"}},
+		},
+		{
+			name: "no placeholder",
+			in:   map[string]interface{}{"kind": "ConfigMap", "data": map[string]interface{}{"list": []interface{}{"{{ name }}"}}},
+			want: map[string]interface{}{"kind": "ConfigMap", "data": map[string]interface{}{"list": []interface{}{"{{ name }}"}}},
+		},
+		{
+			name: "unresolved full placeholder",
+			in:   map[string]interface{}{"spec": map[string]interface{}{"replicas": "{{ missing }}"}},
+			code: errors.UnresolvedPlaceholderCode,
+		},
+		{
+			name: "unresolved placeholder within a string",
+			in:   map[string]interface{}{"metadata": map[string]interface{}{"name": "{{ name }}-{{ missing }}"}},
+			code: errors.UnresolvedPlaceholderCode,
+		},
+		{
+			name: "non-string value within a string",
+			in:   map[string]interface{}{"metadata": map[string]interface{}{"name": "{{ name }}-{{ replicas }}"}},
+			code: errors.TypeMismatchCode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReplacePlaceholders(tt.in, vals)
+			code, _ := errors.CodeOf(err)
+			if code != tt.code {
+				t.Fatalf("ReplacePlaceholders() error = %v, want code %q", err, tt.code)
+			}
+			if err != nil {
+				if ctx := errors.ContextOf(err); ctx.Path != ".spec.replicas" && ctx.Path != ".metadata.name" {
+					t.Errorf("ReplacePlaceholders() error has path %q", ctx.Path)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReplacePlaceholders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
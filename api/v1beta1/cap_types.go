@@ -53,6 +53,11 @@ type CapInput struct {
 	// +kubebuilder:validation:Optional
 	Optional bool `json:"optional"`
 
+	// Description tells App authors what this Input is for. Shown in the catalog.
+	//
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+
 	// TransformationIdentifier identifies the replacement placeholder.
 	//
 	// +kubebuilder:validation:Optional
@@ -62,17 +67,42 @@ type CapInput struct {
 // CapInputs is a list of CapInputs
 type CapInputs []CapInput
 
-// RepoAuth references authentication credentials for a Helm Chart Repo
+// RepoAuth references authentication credentials for a git repository. Either Username and Password for HTTPS basic
+// auth, or SSH can be given. All referenced Secrets and ConfigMaps are read from the namespace of the Cap (or CapDep).
 type RepoAuth struct {
 	// Username is the username to authenticate with for the Repository
 	//
-	// +kubebuilder:validation:Required
-	Username v1.EnvVarSource `json:"username"`
+	// +kubebuilder:validation:Optional
+	Username *v1.EnvVarSource `json:"username,omitempty"`
 
 	// Password is the password to authenticate with for the Repository
 	//
+	// +kubebuilder:validation:Optional
+	Password *v1.EnvVarSource `json:"password,omitempty"`
+
+	// SSH references a Secret holding an SSH private key and known_hosts to authenticate with for the Repository
+	//
+	// +kubebuilder:validation:Optional
+	SSH *SSHRepoAuth `json:"ssh,omitempty"`
+}
+
+// SSHRepoAuth references a Secret holding SSH credentials for a git repository
+type SSHRepoAuth struct {
+	// SecretName is the name of the Secret holding the SSH credentials
+	//
 	// +kubebuilder:validation:Required
-	Password v1.EnvVarSource `json:"password"`
+	SecretName string `json:"secretName"`
+
+	// PrivateKeyKey is the key of the private key in the Secret. Defaults to "identity".
+	//
+	// +kubebuilder:validation:Optional
+	PrivateKeyKey string `json:"privateKeyKey,omitempty"`
+
+	// KnownHostsKey is the key of the known_hosts in the Secret. Defaults to "known_hosts". Host keys are always
+	// verified, so this key has to exist.
+	//
+	// +kubebuilder:validation:Optional
+	KnownHostsKey string `json:"knownHostsKey,omitempty"`
 }
 
 // RepoSpec specifies a specific git repository and revision
@@ -127,6 +157,156 @@ type CapSource struct {
 	InLine json.RawMessage `json:"inline,omitempty"`
 }
 
+// OutputSourceType specifies where the value of a CapOutput is read from
+type OutputSourceType string
+
+const (
+	// RenderedOutputSourceType reads an output from the objects as rendered from the Cap source
+	RenderedOutputSourceType OutputSourceType = "rendered"
+
+	// LiveOutputSourceType reads an output from the object as it currently exists in the cluster. This is also the
+	// way to read outputs from resources created by a HelmRelease.
+	LiveOutputSourceType OutputSourceType = "live"
+)
+
+// CapOutputObjectRef identifies the object a CapOutput is read from. Name and Namespace may contain placeholders,
+// which are rendered with the App's values, plus "shipcaps.app.name" and "shipcaps.app.namespace".
+type CapOutputObjectRef struct {
+	// APIVersion of the referenced object
+	//
+	// +kubebuilder:validation:Required
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the referenced object
+	//
+	// +kubebuilder:validation:Required
+	Kind string `json:"kind"`
+
+	// Name of the referenced object
+	//
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the referenced object. Defaults to the namespace of the App.
+	//
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CapOutput defines a value that Apps of this Cap publish for other Apps to consume
+type CapOutput struct {
+	// Name is the name other Apps use to reference this output
+	//
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// From specifies whether the output is read from the rendered or the live object
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=rendered;live
+	From OutputSourceType `json:"from,omitempty"`
+
+	// Object identifies the object to read the output from
+	//
+	// +kubebuilder:validation:Required
+	Object CapOutputObjectRef `json:"object"`
+
+	// JSONPath is the path to the value inside of the object (e.g. "{.spec.clusterIP}")
+	//
+	// +kubebuilder:validation:Required
+	JSONPath string `json:"jsonPath"`
+
+	// Sensitive outputs are only published into the generated outputs Secret, never into the App status
+	//
+	// +kubebuilder:validation:Optional
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// FieldSelector selects fields of rendered objects
+type FieldSelector struct {
+	// Kind of the objects this selector applies to
+	//
+	// +kubebuilder:validation:Required
+	Kind string `json:"kind"`
+
+	// Name of the object this selector applies to. Applies to all objects of Kind, if not set.
+	//
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// Paths are the selected field paths (e.g. ".spec.replicas"). All fields below a path are included.
+	//
+	// +kubebuilder:validation:Required
+	Paths []string `json:"paths"`
+}
+
+// DriftMode specifies how shipcaps handles drift between the rendered and the live objects of an App
+type DriftMode string
+
+const (
+	// CorrectDriftMode reverts drifted fields to their rendered values
+	CorrectDriftMode DriftMode = "Correct"
+
+	// ReportDriftMode only reports drifted fields, without changing them
+	ReportDriftMode DriftMode = "Report"
+)
+
+// DriftPolicy specifies how shipcaps handles out-of-band changes to the objects it applied
+type DriftPolicy struct {
+	// Mode specifies whether drift is corrected or only reported. Defaults to Correct.
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Correct;Report
+	Mode DriftMode `json:"mode,omitempty"`
+
+	// Ignore selects fields that are neither reported nor corrected when drifted
+	//
+	// +kubebuilder:validation:Optional
+	Ignore []FieldSelector `json:"ignore,omitempty"`
+}
+
+// RolloutStrategy specifies in which steps a new Cap revision is rolled out to its Apps
+type RolloutStrategy string
+
+const (
+	// AllAtOnceRolloutStrategy updates all Apps at once
+	AllAtOnceRolloutStrategy RolloutStrategy = "AllAtOnce"
+
+	// BatchRolloutStrategy updates a fixed number of Apps per step
+	BatchRolloutStrategy RolloutStrategy = "Batch"
+
+	// PercentageRolloutStrategy updates a percentage of all Apps per step
+	PercentageRolloutStrategy RolloutStrategy = "Percentage"
+)
+
+// RolloutPolicy specifies how a new Cap revision is rolled out to its Apps. A step is only taken while all Apps
+// updated in previous steps are Ready.
+type RolloutPolicy struct {
+	// Strategy specifies the size of the steps. Defaults to AllAtOnce.
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=AllAtOnce;Batch;Percentage
+	Strategy RolloutStrategy `json:"strategy,omitempty"`
+
+	// BatchSize is the number of Apps updated per step with the Batch strategy
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	BatchSize int32 `json:"batchSize,omitempty"`
+
+	// Percentage is the percentage of all Apps updated per step with the Percentage strategy
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Percentage int32 `json:"percentage,omitempty"`
+
+	// Pause is the minimum time between two steps
+	//
+	// +kubebuilder:validation:Optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
 // CapSpec defines the desired state of Cap
 type CapSpec struct {
 	// Inputs specify all Inputs that can be given to our Cap
@@ -148,6 +328,170 @@ type CapSpec struct {
 	//
 	// +kubebuilder:validation:Optional
 	Dependencies []v1.ObjectReference `json:"dependencies,omitempty"`
+
+	// Outputs specify values that Apps of this Cap publish for other Apps to consume
+	//
+	// +kubebuilder:validation:Optional
+	Outputs []CapOutput `json:"outputs,omitempty"`
+
+	// ForceOwnership selects fields of the rendered objects that are applied, even if they are managed by another
+	// field manager. Conflicting fields that are not selected are left to their current manager.
+	//
+	// +kubebuilder:validation:Optional
+	ForceOwnership []FieldSelector `json:"forceOwnership,omitempty"`
+
+	// DriftPolicy specifies how out-of-band changes to the objects of this Cap's Apps are handled. Apps can override it.
+	//
+	// +kubebuilder:validation:Optional
+	DriftPolicy *DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Suspend stops all Apps of this Cap from being rendered and applied, until it is set to false again
+	//
+	// +kubebuilder:validation:Optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Version is the semantic version of this Cap. Apps can pin a version or a range of versions.
+	//
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// Rollout specifies how new revisions of this Cap are rolled out to its Apps
+	//
+	// +kubebuilder:validation:Optional
+	Rollout *RolloutPolicy `json:"rollout,omitempty"`
+
+	// TargetNamespaces restricts the namespaces other than their own the Apps of this Cap may write objects into,
+	// within the namespaces the operator allows. "*" matches any namespace. Defaults to all the operator allows.
+	//
+	// +kubebuilder:validation:Optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// ServiceAccountName is the name of a ServiceAccount in the namespace of each App, that the App's rendered
+	// objects are applied as, unless the App names one itself
+	//
+	// +kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Consumers restricts the namespaces whose Apps may use this Cap. Apps in the namespace of a Cap may always use
+	// it. Apps in any namespace may use the Cap if not set.
+	//
+	// +kubebuilder:validation:Optional
+	Consumers *CapConsumers `json:"consumers,omitempty"`
+
+	// MaxAppsPerNamespace limits the number of Apps using this Cap in each namespace. Unlimited if not set.
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxAppsPerNamespace *int32 `json:"maxAppsPerNamespace,omitempty"`
+
+	// Catalog describes this Cap for the catalog. Changing it doesn't create a new revision.
+	//
+	// +kubebuilder:validation:Optional
+	Catalog *CapCatalog `json:"catalog,omitempty"`
+}
+
+// CapMaturity tells how mature a Cap is
+type CapMaturity string
+
+const (
+	// ExperimentalCapMaturity identifies a Cap that may still change incompatibly
+	ExperimentalCapMaturity CapMaturity = "experimental"
+	// BetaCapMaturity identifies a Cap that is ready for testing
+	BetaCapMaturity CapMaturity = "beta"
+	// StableCapMaturity identifies a Cap that is ready for production
+	StableCapMaturity CapMaturity = "stable"
+	// DeprecatedCapMaturity identifies a Cap that should not be used for new Apps
+	DeprecatedCapMaturity CapMaturity = "deprecated"
+)
+
+// CapCatalog describes a Cap for the catalog
+type CapCatalog struct {
+	// DisplayName is a human-readable name of the Cap
+	//
+	// +kubebuilder:validation:Optional
+	DisplayName string `json:"displayName,omitempty"`
+
+	// Description tells what the Cap provides
+	//
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+
+	// Owner is the team owning the Cap
+	//
+	// +kubebuilder:validation:Optional
+	Owner string `json:"owner,omitempty"`
+
+	// Maturity is one of experimental, beta, stable or deprecated
+	//
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=experimental;beta;stable;deprecated
+	Maturity CapMaturity `json:"maturity,omitempty"`
+
+	// Tags categorize the Cap, e.g. database or monitoring
+	//
+	// +kubebuilder:validation:Optional
+	Tags []string `json:"tags,omitempty"`
+
+	// IconURL is the URL of an icon of the Cap
+	//
+	// +kubebuilder:validation:Optional
+	IconURL string `json:"iconURL,omitempty"`
+
+	// DocsURL is the URL of the documentation of the Cap
+	//
+	// +kubebuilder:validation:Optional
+	DocsURL string `json:"docsURL,omitempty"`
+
+	// Maintainers are the people to contact about the Cap
+	//
+	// +kubebuilder:validation:Optional
+	Maintainers []CapMaintainer `json:"maintainers,omitempty"`
+
+	// Examples are values of example Apps using the Cap. An example App setting all required inputs is generated if
+	// none are given.
+	//
+	// +kubebuilder:validation:Optional
+	Examples []CapExample `json:"examples,omitempty"`
+}
+
+// CapMaintainer is a maintainer of a Cap
+type CapMaintainer struct {
+	// Name of the maintainer
+	Name string `json:"name"`
+
+	// Email of the maintainer
+	//
+	// +kubebuilder:validation:Optional
+	Email string `json:"email,omitempty"`
+}
+
+// CapExample is an example App using a Cap
+type CapExample struct {
+	// Name of the example App
+	Name string `json:"name"`
+
+	// Description tells what the example shows
+	//
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+
+	// Values of the example App
+	//
+	// +kubebuilder:validation:Optional
+	Values json.RawMessage `json:"values,omitempty"`
+}
+
+// CapConsumers selects the namespaces whose Apps may use a Cap. A namespace is selected if it matches either field.
+type CapConsumers struct {
+	// Namespaces lists the namespaces, as glob patterns (e.g. "team-*")
+	//
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects namespaces by their labels
+	//
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 }
 
 // CapStatus defines the observed state of Cap
@@ -156,10 +500,111 @@ type CapStatus struct {
 	//
 	// ObservedGeneration holds the generation (metadata.generation in CR) observed by the controller
 	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// Revision is the latest revision of this Cap
+	//
+	// +kubebuilder:validation:Optional
+	Revision int64 `json:"revision,omitempty"`
+
+	// Revisions lists all recorded revisions of this Cap, oldest first
+	//
+	// +kubebuilder:validation:Optional
+	Revisions []CapRevision `json:"revisions,omitempty"`
+
+	// Rollout describes the rollout of the latest revision to the Apps of this Cap
+	//
+	// +kubebuilder:validation:Optional
+	Rollout *CapRollout `json:"rollout,omitempty"`
+
+	// PolicyViolations lists the violations of CapPolicies by the InLine manifests of this Cap
+	//
+	// +kubebuilder:validation:Optional
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+
+	// Usage sums up the resources requested by the Apps of this Cap. The charts of helmchart Caps are not accounted,
+	// so only their Apps are counted.
+	//
+	// +kubebuilder:validation:Optional
+	Usage *CapUsage `json:"usage,omitempty"`
+}
+
+// CapUsage sums up the resources requested by the Apps of a Cap, in total and per namespace
+type CapUsage struct {
+	// Apps is the number of Apps using the Cap
+	Apps int32 `json:"apps"`
+
+	// Requests is the sum of the resources requested by all Apps
+	//
+	// +kubebuilder:validation:Optional
+	Requests v1.ResourceList `json:"requests,omitempty"`
+
+	// Namespaces breaks the usage down by the namespace of the Apps
+	//
+	// +kubebuilder:validation:Optional
+	Namespaces []NamespaceUsage `json:"namespaces,omitempty"`
+}
+
+// NamespaceUsage sums up the resources requested by the Apps of a Cap in one namespace
+type NamespaceUsage struct {
+	// Namespace of the Apps
+	Namespace string `json:"namespace"`
+
+	// Apps is the number of Apps using the Cap in the namespace
+	Apps int32 `json:"apps"`
+
+	// Requests is the sum of the resources requested by the Apps in the namespace
+	//
+	// +kubebuilder:validation:Optional
+	Requests v1.ResourceList `json:"requests,omitempty"`
+}
+
+// CapRevision describes an immutable revision of a Cap's spec
+type CapRevision struct {
+	// Revision is the number of this revision
+	Revision int64 `json:"revision"`
+
+	// Version is the version the Cap specified in this revision
+	//
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// Generation is the generation of the Cap this revision was recorded from
+	Generation int64 `json:"generation"`
+
+	// Hash is the hash of the Cap's spec in this revision
+	Hash string `json:"hash"`
+}
+
+// CapRollout describes the rollout of a Cap revision
+type CapRollout struct {
+	// Revision is the revision being rolled out
+	Revision int64 `json:"revision"`
+
+	// UpdatedApps lists the Apps (as namespace/name) that are allowed to update to the revision in the current step.
+	// Apps already using the revision stay allowed without being listed, so the list never outgrows a step.
+	//
+	// +kubebuilder:validation:Optional
+	UpdatedApps []string `json:"updatedApps,omitempty"`
+
+	// Complete is true once all Apps are allowed to update to the revision
+	//
+	// +kubebuilder:validation:Optional
+	Complete bool `json:"complete,omitempty"`
+
+	// LastStep is the time the last step was taken
+	//
+	// +kubebuilder:validation:Optional
+	LastStep *metav1.Time `json:"lastStep,omitempty"`
+
+	// Message describes the current state of the rollout
+	//
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=caps,shortName=cap
+// +kubebuilder:subresource:status
 
 // Cap is the Schema for the caps API
 type Cap struct {
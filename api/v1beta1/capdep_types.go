@@ -45,6 +45,7 @@ type CapDepStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=capdeps
+// +kubebuilder:subresource:status
 
 // CapDep is the Schema for the capdeps API
 type CapDep struct {
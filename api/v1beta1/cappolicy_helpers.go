@@ -0,0 +1,177 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// matchesField returns true if the selector field is empty or "*", or equals the value
+func matchesField(sel, value string) bool {
+	return sel == "" || sel == "*" || sel == value
+}
+
+// Matches returns true if the selector selects objects of the given kind
+func (sel *KindSelector) Matches(gvk schema.GroupVersionKind) bool {
+	return matchesField(sel.Group, gvk.Group) && matchesField(sel.Version, gvk.Version) && matchesField(sel.Kind, gvk.Kind)
+}
+
+// matchesAnyKind returns true if any of the selectors selects objects of the given kind
+func matchesAnyKind(sels []KindSelector, gvk schema.GroupVersionKind) bool {
+	for _, sel := range sels {
+		if sel.Matches(gvk) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyPattern returns true if the value matches any of the given glob patterns
+func matchesAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPlaceholder returns true if the value contains a placeholder. Unrendered values can't be checked.
+func hasPlaceholder(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// AppliesTo returns true if the policy restricts the given Cap. ClusterCaps are passed as Cap without namespace.
+func (p *CapPolicy) AppliesTo(cap *Cap) bool {
+	if cap.Namespace == "" {
+		return p.Spec.ClusterCaps
+	}
+	return len(p.Spec.Namespaces) == 0 || matchesAnyPattern(p.Spec.Namespaces, cap.Namespace)
+}
+
+// restricts returns true if the policy restricts the rendered objects in any way
+func (p *CapPolicy) restricts() bool {
+	spec := p.Spec
+	return len(spec.AllowedKinds) > 0 || len(spec.DeniedKinds) > 0 || len(spec.AllowedNamespaces) > 0 ||
+		len(spec.DeniedNamespaces) > 0 || len(spec.Rules) > 0
+}
+
+// CheckSource returns the violation of the policy by the source of the given Cap, or "" if there is none. The
+// objects of helm charts are rendered by the helm-operator and can't be checked, so restrictive policies reject
+// helmchart sources unless they allow them explicitly.
+func (p *CapPolicy) CheckSource(cap *Cap) string {
+	if cap.Spec.Source.Type != HelmChartCapSourceType || p.Spec.AllowHelmCharts || !p.restricts() {
+		return ""
+	}
+	return fmt.Sprintf("CapPolicy '%s': helmchart sources are not allowed, as the objects of their charts can't be checked", p.Name)
+}
+
+// Check returns the violations of the policy by the given object. Values that still contain placeholders are not
+// checked, so manifests can be checked before they are rendered.
+func (p *CapPolicy) Check(obj unstructured.Unstructured) []string {
+	gvk := obj.GroupVersionKind()
+	object := fmt.Sprintf("%s %s", gvk.Kind, obj.GetName())
+	if obj.GetNamespace() != "" {
+		object = fmt.Sprintf("%s %s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName())
+	}
+	violation := func(msg string) string {
+		return fmt.Sprintf("CapPolicy '%s': %s: %s", p.Name, object, msg)
+	}
+
+	var violations []string
+	if len(p.Spec.AllowedKinds) > 0 && !matchesAnyKind(p.Spec.AllowedKinds, gvk) {
+		violations = append(violations, violation("kind is not allowed"))
+	}
+	if matchesAnyKind(p.Spec.DeniedKinds, gvk) {
+		violations = append(violations, violation("kind is denied"))
+	}
+	if ns := obj.GetNamespace(); ns != "" && !hasPlaceholder(ns) {
+		if len(p.Spec.AllowedNamespaces) > 0 && !matchesAnyPattern(p.Spec.AllowedNamespaces, ns) {
+			violations = append(violations, violation(fmt.Sprintf("namespace '%s' is not allowed", ns)))
+		}
+		if matchesAnyPattern(p.Spec.DeniedNamespaces, ns) {
+			violations = append(violations, violation(fmt.Sprintf("namespace '%s' is denied", ns)))
+		}
+	}
+	for _, rule := range p.Spec.Rules {
+		if len(rule.Kinds) > 0 && !matchesAnyKind(rule.Kinds, gvk) {
+			continue
+		}
+		if msg := rule.check(obj); msg != "" {
+			violations = append(violations, violation(msg))
+		}
+	}
+	return violations
+}
+
+// check returns why the given object violates the rule, or "" if it doesn't
+func (rule *FieldRule) check(obj unstructured.Unstructured) string {
+	expr := rule.JSONPath
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	jp := jsonpath.New(rule.JSONPath).AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return fmt.Sprintf("invalid jsonPath '%s': %s", rule.JSONPath, err)
+	}
+	results, err := jp.FindResults(obj.Object)
+	if err != nil {
+		// The path does not exist in this object, which satisfies the rule.
+		return ""
+	}
+
+	for _, result := range results {
+		for _, value := range result {
+			str := fmt.Sprint(value.Interface())
+			if hasPlaceholder(str) {
+				continue
+			}
+			if (rule.Operator == EqualsFieldRuleOperator) == (str == rule.Value) {
+				continue
+			}
+			if rule.Message != "" {
+				return rule.Message
+			}
+			if rule.Operator == EqualsFieldRuleOperator {
+				return fmt.Sprintf("%s is '%s', but must be '%s'", rule.JSONPath, str, rule.Value)
+			}
+			return fmt.Sprintf("%s must not be '%s'", rule.JSONPath, str)
+		}
+	}
+	return ""
+}
+
+// CheckPolicies returns the violations of the given objects of a Cap against all policies that apply to the Cap
+func CheckPolicies(policies []CapPolicy, cap *Cap, objs []map[string]interface{}) []string {
+	var violations []string
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.AppliesTo(cap) {
+			continue
+		}
+		if violation := policy.CheckSource(cap); violation != "" {
+			violations = append(violations, violation)
+		}
+		for _, obj := range objs {
+			violations = append(violations, policy.Check(unstructured.Unstructured{Object: obj})...)
+		}
+	}
+	return violations
+}
+
+// InLineManifests returns the unrendered InLine manifests of the source
+func (source *CapSource) InLineManifests() ([]map[string]interface{}, error) {
+	var manifests []map[string]interface{}
+	if !source.IsInLine() {
+		return manifests, nil
+	}
+	if err := json.Unmarshal(source.InLine, &manifests); err != nil {
+		return nil, err
+	}
+	return manifests, nil
+}
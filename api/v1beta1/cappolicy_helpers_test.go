@@ -0,0 +1,209 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testDeployment(namespace string, privileged interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": namespace},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "securityContext": map[string]interface{}{"privileged": privileged}},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func TestCapPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CapPolicySpec
+		obj  unstructured.Unstructured
+		want []string
+	}{
+		{name: "empty policy", obj: testDeployment("team-a", false)},
+		{
+			name: "allowed kind",
+			spec: CapPolicySpec{AllowedKinds: []KindSelector{{Group: "apps", Kind: "Deployment"}}},
+			obj:  testDeployment("team-a", false),
+		},
+		{
+			name: "kind not allowed",
+			spec: CapPolicySpec{AllowedKinds: []KindSelector{{Kind: "ConfigMap"}}},
+			obj:  testDeployment("team-a", false),
+			want: []string{"CapPolicy 'test': Deployment team-a/web: kind is not allowed"},
+		},
+		{
+			name: "denied kind",
+			spec: CapPolicySpec{DeniedKinds: []KindSelector{{Group: "*", Kind: "Deployment"}}},
+			obj:  testDeployment("team-a", false),
+			want: []string{"CapPolicy 'test': Deployment team-a/web: kind is denied"},
+		},
+		{
+			name: "namespace not allowed",
+			spec: CapPolicySpec{AllowedNamespaces: []string{"team-*"}},
+			obj:  testDeployment("kube-system", false),
+			want: []string{"CapPolicy 'test': Deployment kube-system/web: namespace 'kube-system' is not allowed"},
+		},
+		{
+			name: "denied namespace",
+			spec: CapPolicySpec{DeniedNamespaces: []string{"kube-*"}},
+			obj:  testDeployment("kube-system", false),
+			want: []string{"CapPolicy 'test': Deployment kube-system/web: namespace 'kube-system' is denied"},
+		},
+		{
+			name: "placeholder namespace",
+			spec: CapPolicySpec{AllowedNamespaces: []string{"team-*"}},
+			obj:  testDeployment("{{ .Values.namespace }}", false),
+		},
+		{
+			name: "rule of other kind",
+			spec: CapPolicySpec{Rules: []FieldRule{{
+				Kinds:    []KindSelector{{Kind: "StatefulSet"}},
+				JSONPath: "{.spec.template.spec.containers[*].securityContext.privileged}",
+				Operator: NotEqualsFieldRuleOperator,
+				Value:    "true",
+			}}},
+			obj: testDeployment("team-a", true),
+		},
+		{
+			name: "violated rule with message",
+			spec: CapPolicySpec{Rules: []FieldRule{{
+				Kinds:    []KindSelector{{Kind: "Deployment"}},
+				JSONPath: "{.spec.template.spec.containers[*].securityContext.privileged}",
+				Operator: NotEqualsFieldRuleOperator,
+				Value:    "true",
+				Message:  "privileged containers are not allowed",
+			}}},
+			obj:  testDeployment("team-a", true),
+			want: []string{"CapPolicy 'test': Deployment team-a/web: privileged containers are not allowed"},
+		},
+		{
+			name: "multiple violations",
+			spec: CapPolicySpec{
+				DeniedKinds:      []KindSelector{{Kind: "Deployment"}},
+				DeniedNamespaces: []string{"default"},
+			},
+			obj: testDeployment("default", false),
+			want: []string{
+				"CapPolicy 'test': Deployment default/web: kind is denied",
+				"CapPolicy 'test': Deployment default/web: namespace 'default' is denied",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &CapPolicy{ObjectMeta: metav1.ObjectMeta{Name: "test"}, Spec: tt.spec}
+			if got := policy.Check(tt.obj); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldRuleCheck(t *testing.T) {
+	const privileged = ".spec.template.spec.containers[*].securityContext.privileged"
+
+	tests := []struct {
+		name string
+		rule FieldRule
+		obj  unstructured.Unstructured
+		want string
+	}{
+		{
+			name: "equals satisfied",
+			rule: FieldRule{JSONPath: "{" + privileged + "}", Operator: EqualsFieldRuleOperator, Value: "false"},
+			obj:  testDeployment("team-a", false),
+		},
+		{
+			name: "equals violated",
+			rule: FieldRule{JSONPath: "{" + privileged + "}", Operator: EqualsFieldRuleOperator, Value: "false"},
+			obj:  testDeployment("team-a", true),
+			want: "{" + privileged + "} is 'true', but must be 'false'",
+		},
+		{
+			name: "not equals satisfied",
+			rule: FieldRule{JSONPath: privileged, Operator: NotEqualsFieldRuleOperator, Value: "true"},
+			obj:  testDeployment("team-a", false),
+		},
+		{
+			name: "not equals violated without braces",
+			rule: FieldRule{JSONPath: privileged, Operator: NotEqualsFieldRuleOperator, Value: "true"},
+			obj:  testDeployment("team-a", true),
+			want: privileged + " must not be 'true'",
+		},
+		{
+			name: "custom message",
+			rule: FieldRule{JSONPath: privileged, Operator: NotEqualsFieldRuleOperator, Value: "true", Message: "no privileges"},
+			obj:  testDeployment("team-a", true),
+			want: "no privileges",
+		},
+		{
+			name: "missing field",
+			rule: FieldRule{JSONPath: "{.spec.replicas}", Operator: EqualsFieldRuleOperator, Value: "1"},
+			obj:  testDeployment("team-a", true),
+		},
+		{
+			name: "placeholder value",
+			rule: FieldRule{JSONPath: privileged, Operator: NotEqualsFieldRuleOperator, Value: "true"},
+			obj:  testDeployment("team-a", "{{ .Values.privileged }}"),
+		},
+		{
+			name: "invalid path",
+			rule: FieldRule{JSONPath: "{.spec[}", Operator: EqualsFieldRuleOperator, Value: "1"},
+			obj:  testDeployment("team-a", true),
+			want: "invalid jsonPath '{.spec[}': unterminated array",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.check(tt.obj); got != tt.want {
+				t.Errorf("check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPoliciesHelmChartSource(t *testing.T) {
+	restrictive := CapPolicySpec{DeniedKinds: []KindSelector{{Kind: "ClusterRoleBinding"}}}
+	allowing := restrictive
+	allowing.AllowHelmCharts = true
+
+	tests := []struct {
+		name       string
+		source     CapSourceType
+		spec       CapPolicySpec
+		violations int
+	}{
+		{name: "simple source", source: SimpleCapSourceType, spec: restrictive},
+		{name: "helmchart source", source: HelmChartCapSourceType, spec: restrictive, violations: 1},
+		{name: "helmchart source allowed", source: HelmChartCapSourceType, spec: allowing},
+		{name: "helmchart source without restrictions", source: HelmChartCapSourceType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies := []CapPolicy{{ObjectMeta: metav1.ObjectMeta{Name: "test"}, Spec: tt.spec}}
+			cap := &Cap{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       CapSpec{Source: CapSource{Type: tt.source}},
+			}
+			if got := CheckPolicies(policies, cap, nil); len(got) != tt.violations {
+				t.Errorf("CheckPolicies() = %q, want %d violations", got, tt.violations)
+			}
+		})
+	}
+}
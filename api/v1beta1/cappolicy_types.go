@@ -0,0 +1,149 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KindSelector selects objects by their group, version and kind. Empty fields and "*" match any value.
+type KindSelector struct {
+	// Group of the selected objects
+	//
+	// +kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+
+	// Version of the selected objects
+	//
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// Kind of the selected objects
+	//
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// FieldRuleOperator specifies how a FieldRule compares the selected values
+type FieldRuleOperator string
+
+const (
+	// EqualsFieldRuleOperator requires all selected values to equal the value of the rule
+	EqualsFieldRuleOperator FieldRuleOperator = "Equals"
+
+	// NotEqualsFieldRuleOperator requires no selected value to equal the value of the rule
+	NotEqualsFieldRuleOperator FieldRuleOperator = "NotEquals"
+)
+
+// FieldRule restricts the values of a field of rendered objects. Objects without the field satisfy the rule.
+type FieldRule struct {
+	// Kinds selects the objects the rule applies to. Applies to all objects if empty.
+	//
+	// +kubebuilder:validation:Optional
+	Kinds []KindSelector `json:"kinds,omitempty"`
+
+	// JSONPath selects the values to compare (e.g. "{.spec.template.spec.containers[*].securityContext.privileged}")
+	//
+	// +kubebuilder:validation:Required
+	JSONPath string `json:"jsonPath"`
+
+	// Operator specifies how the selected values are compared to Value
+	//
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Equals;NotEquals
+	Operator FieldRuleOperator `json:"operator"`
+
+	// Value is compared to the selected values, in their string form (e.g. "true")
+	//
+	// +kubebuilder:validation:Required
+	Value string `json:"value"`
+
+	// Message describes the rule in reported violations
+	//
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// CapPolicySpec defines the desired state of CapPolicy
+type CapPolicySpec struct {
+	// Namespaces selects the Caps the policy applies to by their namespace, as glob patterns (e.g. "team-*").
+	// Applies to Caps in all namespaces if empty.
+	//
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// ClusterCaps makes the policy apply to ClusterCaps as well
+	//
+	// +kubebuilder:validation:Optional
+	ClusterCaps bool `json:"clusterCaps,omitempty"`
+
+	// AllowedKinds restricts the rendered objects to the selected kinds. All kinds are allowed if empty.
+	//
+	// +kubebuilder:validation:Optional
+	AllowedKinds []KindSelector `json:"allowedKinds,omitempty"`
+
+	// DeniedKinds lists kinds that may not be rendered
+	//
+	// +kubebuilder:validation:Optional
+	DeniedKinds []KindSelector `json:"deniedKinds,omitempty"`
+
+	// AllowedNamespaces restricts the namespaces of rendered objects, as glob patterns. All namespaces are allowed if
+	// empty.
+	//
+	// +kubebuilder:validation:Optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// DeniedNamespaces lists namespaces rendered objects may not be in, as glob patterns
+	//
+	// +kubebuilder:validation:Optional
+	DeniedNamespaces []string `json:"deniedNamespaces,omitempty"`
+
+	// Rules restrict the values of fields of rendered objects
+	//
+	// +kubebuilder:validation:Optional
+	Rules []FieldRule `json:"rules,omitempty"`
+
+	// AllowHelmCharts allows Caps with a helmchart source, although the objects of their charts are rendered by the
+	// helm-operator and can't be checked. Only the HelmRelease is checked against the policy.
+	//
+	// +kubebuilder:validation:Optional
+	AllowHelmCharts bool `json:"allowHelmCharts,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=cappolicies,scope=Cluster,shortName=cappolicy
+
+// CapPolicy is the Schema for the cappolicies API. It restricts what the Caps it applies to may render.
+type CapPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CapPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CapPolicyList contains a list of CapPolicy
+type CapPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CapPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CapPolicy{}, &CapPolicyList{})
+}
@@ -0,0 +1,94 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+// GetCatalog returns the catalog description of the Cap, which is empty if it has none
+func (cap *Cap) GetCatalog() CapCatalog {
+	if cap.Spec.Catalog == nil {
+		return CapCatalog{}
+	}
+	return *cap.Spec.Catalog
+}
+
+// MatchesSearch returns true if the name, display name, description or any tag of the Cap contains the query,
+// ignoring case
+func (cap *Cap) MatchesSearch(query string) bool {
+	query = strings.ToLower(query)
+	catalog := cap.GetCatalog()
+	for _, field := range append([]string{cap.Name, catalog.DisplayName, catalog.Description}, catalog.Tags...) {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag returns true if the Cap is tagged with the given tag, ignoring case
+func (cap *Cap) HasTag(tag string) bool {
+	for _, t := range cap.GetCatalog().Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExampleApps returns the example Apps of the Cap, in the given namespace. If the Cap has no examples, a single
+// example App is generated, which sets all required inputs to a value of their type.
+func (cap *Cap) ExampleApps(namespace string) ([]App, error) {
+	examples := cap.GetCatalog().Examples
+	if len(examples) == 0 {
+		var values parsing.AppValues
+		for _, in := range cap.Spec.Inputs {
+			if !in.Optional {
+				values = append(values, parsing.AppValue{Key: in.Key, Value: exampleValue(in.Type)})
+			}
+		}
+		raw, err := values.Raw()
+		if err != nil {
+			return nil, err
+		}
+		examples = []CapExample{{Name: cap.Name, Values: json.RawMessage(raw)}}
+	}
+
+	apps := make([]App, 0, len(examples))
+	for _, example := range examples {
+		app := App{
+			TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "App"},
+			ObjectMeta: metav1.ObjectMeta{Name: example.Name, Namespace: namespace},
+			Spec:       AppSpec{Values: example.Values},
+		}
+		if example.Description != "" {
+			app.Annotations = map[string]string{"description": example.Description}
+		}
+		if cap.Namespace == "" {
+			app.Spec.ClusterCapRef = &v1.ObjectReference{Name: cap.Name}
+		} else {
+			app.Spec.CapRef = &v1.ObjectReference{Name: cap.Name, Namespace: cap.Namespace}
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// exampleValue returns a value of the given input type
+func exampleValue(t ValueType) interface{} {
+	switch t {
+	case IntInputType:
+		return 1
+	case FloatInputType:
+		return 1.5
+	case StringListInputType:
+		return []string{"example"}
+	default:
+		return "example"
+	}
+}
@@ -0,0 +1,83 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestExampleApps(t *testing.T) {
+	inputs := CapInputs{
+		{Key: "name", Type: StringInputType, TargetIdentifier: "name"},
+		{Key: "replicas", Type: IntInputType, TargetIdentifier: "replicas"},
+		{Key: "ratio", Type: FloatInputType, TargetIdentifier: "ratio"},
+		{Key: "hosts", Type: StringListInputType, TargetIdentifier: "hosts"},
+		{Key: "color", Type: StringInputType, TargetIdentifier: "color", Optional: true},
+	}
+
+	t.Run("generated", func(t *testing.T) {
+		cap := &Cap{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "platform"}, Spec: CapSpec{Inputs: inputs}}
+		apps, err := cap.ExampleApps("team-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(apps) != 1 {
+			t.Fatalf("ExampleApps() returned %d apps, want 1", len(apps))
+		}
+		app := apps[0]
+		if app.Name != "web" || app.Namespace != "team-a" || app.Spec.CapRef == nil || app.Spec.CapRef.Namespace != "platform" {
+			t.Errorf("ExampleApps() = %s/%s referencing %v", app.Namespace, app.Name, app.Spec.CapRef)
+		}
+
+		avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{
+			"name":     "example",
+			"replicas": float64(1),
+			"ratio":    1.5,
+			"hosts":    []interface{}{"example"},
+		}
+		if got := avs.Map(); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExampleApps() values = %v, want %v", got, want)
+		}
+		// The example must be valid for the Cap.
+		if err := cap.ValidateValues(&app); err != nil {
+			t.Errorf("ExampleApps() values don't satisfy the inputs: %v", err)
+		}
+	})
+
+	t.Run("catalog examples of a ClusterCap", func(t *testing.T) {
+		cap := &Cap{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: CapSpec{Inputs: inputs, Catalog: &CapCatalog{Examples: []CapExample{
+				{Name: "small", Description: "A single replica", Values: json.RawMessage(`[{"key":"replicas","value":1}]`)},
+				{Name: "large", Values: json.RawMessage(`[{"key":"replicas","value":5}]`)},
+			}}},
+		}
+		apps, err := cap.ExampleApps("default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(apps) != 2 {
+			t.Fatalf("ExampleApps() returned %d apps, want 2", len(apps))
+		}
+		for i, name := range []string{"small", "large"} {
+			app := apps[i]
+			if app.Name != name || app.Spec.ClusterCapRef == nil || app.Spec.CapRef != nil {
+				t.Errorf("ExampleApps()[%d] = %s referencing %v, want %s referencing the ClusterCap", i, app.Name, app.Spec.ClusterCapRef, name)
+			}
+		}
+		if got := apps[0].Annotations["description"]; got != "A single replica" {
+			t.Errorf("ExampleApps()[0] description = %q", got)
+		}
+		if apps[1].Annotations != nil {
+			t.Errorf("ExampleApps()[1] annotations = %v, want none", apps[1].Annotations)
+		}
+	})
+}
@@ -40,6 +40,7 @@ type ClusterCapStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=clustercaps,scope=Cluster,shortName=clustercap
+// +kubebuilder:subresource:status
 
 // ClusterCap is the Schema for the clustercaps API
 type ClusterCap Cap
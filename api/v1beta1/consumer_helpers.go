@@ -0,0 +1,118 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// GetCap fetches the Cap or ClusterCap referenced by the App. ClusterCaps are returned as Cap without namespace.
+func (app *App) GetCap(ctx context.Context, c client.Reader) (Cap, error) {
+	var cap Cap
+	if app.Spec.ClusterCapRef != nil && app.Spec.CapRef != nil {
+		return cap, fmt.Errorf("both ClusterCapRef and CapRef set")
+	}
+	if app.Spec.ClusterCapRef == nil && app.Spec.CapRef == nil {
+		return cap, fmt.Errorf("neither ClusterCapRef nor CapRef set")
+	}
+
+	// Get the referenced ClusterCap
+	if app.Spec.ClusterCapRef != nil {
+		clusterCap := ClusterCap{}
+		key := client.ObjectKey{
+			Name: app.Spec.ClusterCapRef.Name,
+		}
+		if err := c.Get(ctx, key, &clusterCap); err != nil {
+			return cap, err
+		}
+		return Cap(clusterCap), nil
+	}
+
+	// Get the referenced Cap
+	key := client.ObjectKey{
+		Namespace: app.Spec.CapRef.Namespace,
+		Name:      app.Spec.CapRef.Name,
+	}
+	if err := c.Get(ctx, key, &cap); err != nil {
+		return cap, err
+	}
+	return cap, nil
+}
+
+// AllowsConsumer returns true if Apps in the given namespace, with the given labels, may use the Cap
+func (cap *Cap) AllowsConsumer(namespace string, nsLabels map[string]string) (bool, error) {
+	consumers := cap.Spec.Consumers
+	if consumers == nil || namespace == cap.Namespace {
+		return true, nil
+	}
+	if matchesAnyPattern(consumers.Namespaces, namespace) {
+		return true, nil
+	}
+	if consumers.NamespaceSelector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(consumers.NamespaceSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid consumer namespaceSelector: %w", err)
+	}
+	return selector.Matches(labels.Set(nsLabels)), nil
+}
+
+// CheckConsumer returns an error if the given App may not use the Cap. The labels of the App's namespace are read
+// with the given client, if the Cap selects namespaces by label.
+func (cap *Cap) CheckConsumer(ctx context.Context, c client.Reader, app *App) error {
+	var nsLabels map[string]string
+	if consumers := cap.Spec.Consumers; consumers != nil && consumers.NamespaceSelector != nil {
+		ns := v1.Namespace{}
+		// A namespace that doesn't exist has no labels.
+		if err := c.Get(ctx, client.ObjectKey{Name: app.Namespace}, &ns); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to get namespace '%s': %w", app.Namespace, err)
+		}
+		nsLabels = ns.Labels
+	}
+	allowed, err := cap.AllowsConsumer(app.Namespace, nsLabels)
+	if err != nil {
+		return errors.Wrap(errors.CapNotAllowedCode, err, "").With(errors.Context{App: app.AppKey(), Cap: cap.CapKey()})
+	}
+	if !allowed {
+		return errors.NewShipCapsError(errors.CapNotAllowedCode,
+			fmt.Sprintf("%s '%s' may not be used from namespace '%s'", cap.KindName(), cap.CapKey(), app.Namespace)).
+			With(errors.Context{App: app.AppKey(), Cap: cap.CapKey()})
+	}
+	return nil
+}
+
+// CheckAppLimit returns an error if the given App exceeds the maximum number of Apps per namespace of the Cap. The
+// oldest Apps in a namespace are within the limit, and an App that was not created yet is the newest.
+func (cap *Cap) CheckAppLimit(ctx context.Context, c client.Reader, app *App) error {
+	if cap.Spec.MaxAppsPerNamespace == nil {
+		return nil
+	}
+	var apps AppList
+	if err := c.List(ctx, &apps, client.InNamespace(app.Namespace)); err != nil {
+		return fmt.Errorf("unable to list Apps in namespace '%s': %w", app.Namespace, err)
+	}
+
+	older := 0
+	for _, other := range apps.Items {
+		if other.Name == app.Name || !other.ReferencesCap(cap.Name, cap.Namespace) {
+			continue
+		}
+		if app.CreationTimestamp.IsZero() || other.CreationTimestamp.Before(&app.CreationTimestamp) ||
+			(other.CreationTimestamp.Equal(&app.CreationTimestamp) && other.Name < app.Name) {
+			older++
+		}
+	}
+	if max := int(*cap.Spec.MaxAppsPerNamespace); older >= max {
+		return errors.NewShipCapsError(errors.AppLimitExceededCode,
+			fmt.Sprintf("%s '%s' allows at most %d Apps in namespace '%s'", cap.KindName(), cap.CapKey(), max, app.Namespace)).
+			With(errors.Context{App: app.AppKey(), Cap: cap.CapKey()})
+	}
+	return nil
+}
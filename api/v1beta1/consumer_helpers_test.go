@@ -0,0 +1,128 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/redradrat/shipcaps/errors"
+)
+
+func TestAllowsConsumer(t *testing.T) {
+	internal := map[string]string{"tier": "internal"}
+
+	tests := []struct {
+		name      string
+		cluster   bool
+		consumers *CapConsumers
+		namespace string
+		labels    map[string]string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "no restriction", namespace: "team-b", want: true},
+		{name: "own namespace", consumers: &CapConsumers{}, namespace: "platform", want: true},
+		{name: "ClusterCap without consumers", cluster: true, consumers: &CapConsumers{}, namespace: "team-b"},
+		{name: "matching pattern", consumers: &CapConsumers{Namespaces: []string{"team-*"}}, namespace: "team-b", want: true},
+		{name: "other namespace", consumers: &CapConsumers{Namespaces: []string{"team-*"}}, namespace: "default"},
+		{
+			name:      "matching labels",
+			consumers: &CapConsumers{NamespaceSelector: &metav1.LabelSelector{MatchLabels: internal}},
+			namespace: "default",
+			labels:    map[string]string{"tier": "internal", "team": "b"},
+			want:      true,
+		},
+		{
+			name:      "other labels",
+			consumers: &CapConsumers{NamespaceSelector: &metav1.LabelSelector{MatchLabels: internal}},
+			namespace: "default",
+			labels:    map[string]string{"tier": "public"},
+		},
+		{
+			name:      "pattern or labels",
+			consumers: &CapConsumers{Namespaces: []string{"team-*"}, NamespaceSelector: &metav1.LabelSelector{MatchLabels: internal}},
+			namespace: "team-b",
+			want:      true,
+		},
+		{
+			name: "invalid selector",
+			consumers: &CapConsumers{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: "Matches"},
+			}}},
+			namespace: "default",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capNamespace := "platform"
+			if tt.cluster {
+				capNamespace = ""
+			}
+			cap := &Cap{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: capNamespace}, Spec: CapSpec{Consumers: tt.consumers}}
+			got, err := cap.AllowsConsumer(tt.namespace, tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AllowsConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("AllowsConsumer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAppLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = AddToScheme(scheme)
+
+	created := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	app := func(name, capName string, age time.Duration) *App {
+		return &App{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", CreationTimestamp: metav1.NewTime(created.Add(-age))},
+			Spec:       AppSpec{CapRef: &v1.ObjectReference{Name: capName, Namespace: "platform"}},
+		}
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		app("first", "web", 2*time.Hour),
+		app("second", "web", time.Hour),
+		app("same-age", "web", 0),
+		app("other-cap", "db", 3*time.Hour),
+	)
+
+	max := int32(2)
+	tests := []struct {
+		name     string
+		limit    *int32
+		app      *App
+		exceeded bool
+	}{
+		{name: "unlimited", app: app("new", "web", 0)},
+		{name: "within limit", limit: &max, app: app("second", "web", time.Hour)},
+		{name: "older than all others", limit: &max, app: app("first", "web", 2*time.Hour)},
+		{name: "name breaks the tie", limit: &max, app: app("a-same-age", "web", 0), exceeded: true},
+		{name: "exceeding limit", limit: &max, app: app("same-age", "web", 0), exceeded: true},
+		{name: "not created yet", limit: &max, app: &App{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a"},
+			Spec:       AppSpec{CapRef: &v1.ObjectReference{Name: "web", Namespace: "platform"}},
+		}, exceeded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cap := &Cap{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "platform"}, Spec: CapSpec{MaxAppsPerNamespace: tt.limit}}
+			err := cap.CheckAppLimit(context.Background(), c, tt.app)
+			if tt.exceeded != (err != nil) {
+				t.Errorf("CheckAppLimit() = %v, want exceeded %v", err, tt.exceeded)
+			}
+			if err != nil && !errors.IsErr(err, errors.AppLimitExceededCode) {
+				t.Errorf("CheckAppLimit() returned unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package v1beta1
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/redradrat/shipcaps/errors"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+const (
+	// OutputNotAvailableCode identifies errors caused by an output that cannot be read (yet)
+	OutputNotAvailableCode = errors.OutputNotAvailableCode
+)
+
+const (
+	// AppNameTargetIdentifier is available for rendering output object references, and holds the App's name
+	AppNameTargetIdentifier parsing.TargetIdentifier = "shipcaps.app.name"
+	// AppNamespaceTargetIdentifier is available for rendering output object references, and holds the App's namespace
+	AppNamespaceTargetIdentifier parsing.TargetIdentifier = "shipcaps.app.namespace"
+)
+
+// RenderObjectRef renders the placeholders in the output's object reference with the given values, and defaults the
+// namespace to the one of the App.
+func (out *CapOutput) RenderObjectRef(app *App, values parsing.CapValues) (CapOutputObjectRef, error) {
+	vals := append(parsing.CapValues{
+		{TargetIdentifier: AppNameTargetIdentifier, Value: app.Name},
+		{TargetIdentifier: AppNamespaceTargetIdentifier, Value: app.Namespace},
+	}, values...)
+
+	rendered, err := ReplacePlaceholders(map[string]interface{}{
+		"name":      out.Object.Name,
+		"namespace": out.Object.Namespace,
+	}, vals)
+	if err != nil {
+		return CapOutputObjectRef{}, err
+	}
+
+	ref := out.Object
+	ref.Name, _ = rendered["name"].(string)
+	ref.Namespace, _ = rendered["namespace"].(string)
+	if ref.Namespace == "" {
+		ref.Namespace = app.Namespace
+	}
+	return ref, nil
+}
+
+// Matches returns true if the given object is the one referenced. Cluster-scoped objects match regardless of the
+// referenced namespace.
+func (ref CapOutputObjectRef) Matches(obj unstructured.Unstructured) bool {
+	if obj.GetAPIVersion() != ref.APIVersion || obj.GetKind() != ref.Kind || obj.GetName() != ref.Name {
+		return false
+	}
+	return obj.GetNamespace() == "" || obj.GetNamespace() == ref.Namespace
+}
+
+// Extract reads the output's value from the given object
+func (out *CapOutput) Extract(obj unstructured.Unstructured) (string, error) {
+	expr := out.JSONPath
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+
+	jp := jsonpath.New(out.Name)
+	if err := jp.Parse(expr); err != nil {
+		return "", fmt.Errorf("invalid jsonPath for output '%s': %w", out.Name, err)
+	}
+	buf := bytes.Buffer{}
+	if err := jp.Execute(&buf, obj.Object); err != nil {
+		return "", errors.NewShipCapsError(OutputNotAvailableCode, fmt.Sprintf("unable to read output '%s' from %s '%s': %s", out.Name, obj.GetKind(), obj.GetName(), err))
+	}
+	if buf.Len() == 0 {
+		return "", errors.NewShipCapsError(OutputNotAvailableCode, fmt.Sprintf("output '%s' is empty in %s '%s'", out.Name, obj.GetKind(), obj.GetName()))
+	}
+	return buf.String(), nil
+}
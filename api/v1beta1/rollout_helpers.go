@@ -0,0 +1,141 @@
+package v1beta1
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/redradrat/shipcaps/errors"
+)
+
+const (
+	// NoMatchingCapVersionCode identifies errors caused by an App pinning a Cap version no revision matches
+	NoMatchingCapVersionCode = errors.NoMatchingCapVersionCode
+)
+
+// RevisionHash returns a hash of the parts of the Cap's spec that affect rendering. Changes to the settings that
+// always apply as set on the live Cap (see UseRevisionSpec) don't result in a new revision.
+func (spec CapSpec) RevisionHash() (string, error) {
+	spec.setLiveSettings(CapSpec{})
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// UseRevisionSpec replaces the Cap's spec with the spec of one of its revisions. The settings that are no part of
+// revisions are kept as set on the live Cap.
+func (cap *Cap) UseRevisionSpec(spec CapSpec) {
+	spec.setLiveSettings(cap.Spec)
+	cap.Spec = spec
+}
+
+// setLiveSettings sets the settings that are no part of revisions to those of the given spec. These are the rollout
+// policy, suspension, the target namespaces, the ServiceAccount, the catalog description, the allowed consumers and
+// the limit of Apps per namespace.
+func (spec *CapSpec) setLiveSettings(live CapSpec) {
+	spec.Rollout = live.Rollout
+	spec.Suspend = live.Suspend
+	spec.TargetNamespaces = live.TargetNamespaces
+	spec.ServiceAccountName = live.ServiceAccountName
+	spec.Catalog = live.Catalog
+	spec.Consumers = live.Consumers
+	spec.MaxAppsPerNamespace = live.MaxAppsPerNamespace
+}
+
+// CandidateRevisions returns all revisions of the Cap the given App may use according to its CapVersion, oldest
+// first.
+func (cap *Cap) CandidateRevisions(app *App) ([]CapRevision, error) {
+	if app.Spec.CapVersion == "" {
+		return cap.Status.Revisions, nil
+	}
+
+	constraint, err := semver.NewConstraint(app.Spec.CapVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capVersion '%s': %w", app.Spec.CapVersion, err)
+	}
+	var candidates []CapRevision
+	for _, rev := range cap.Status.Revisions {
+		version, err := semver.NewVersion(rev.Version)
+		if err != nil {
+			continue
+		}
+		if constraint.Check(version) {
+			candidates = append(candidates, rev)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.NewShipCapsError(NoMatchingCapVersionCode, fmt.Sprintf("no revision of cap '%s' matches version '%s'", cap.Name, app.Spec.CapVersion))
+	}
+	return candidates, nil
+}
+
+// SelectRevision returns the revision of the Cap the given App should be rendered from. This is the latest candidate
+// revision, unless it is still being rolled out and the App was not admitted yet, in which case the App stays on its
+// current revision. Returns nil if the Cap has no revisions recorded yet.
+func (cap *Cap) SelectRevision(app *App) (*CapRevision, error) {
+	candidates, err := cap.CandidateRevisions(app)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	latest := candidates[len(candidates)-1]
+	rollout := cap.Status.Rollout
+	if rollout == nil || rollout.Revision != latest.Revision || rollout.Admits(app) ||
+		app.Status.CapRevision == 0 || app.Status.CapRevision >= latest.Revision {
+		return &latest, nil
+	}
+
+	// Stay on the current revision, or the newest one before the rollout, if the current one is no candidate anymore.
+	for i := len(candidates) - 2; i >= 0; i-- {
+		if candidates[i].Revision <= app.Status.CapRevision {
+			return &candidates[i], nil
+		}
+	}
+	return &latest, nil
+}
+
+// AppKey returns the key identifying the App in a CapRollout
+func (app *App) AppKey() string {
+	return app.Namespace + "/" + app.Name
+}
+
+// CapKey returns the namespace/name of the Cap, or only the name for ClusterCaps
+func (cap *Cap) CapKey() string {
+	if cap.Namespace == "" {
+		return cap.Name
+	}
+	return cap.Namespace + "/" + cap.Name
+}
+
+// KindName returns the kind of the Cap, which is ClusterCap if it has no namespace
+func (cap *Cap) KindName() string {
+	if cap.Namespace == "" {
+		return "ClusterCap"
+	}
+	return "Cap"
+}
+
+// Admits returns true if the given App may update to the revision being rolled out, or already did
+func (rollout *CapRollout) Admits(app *App) bool {
+	if rollout.Complete || app.Status.CapRevision == rollout.Revision {
+		return true
+	}
+	for _, key := range rollout.UpdatedApps {
+		if key == app.AppKey() {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferencesCap returns true if the App references the named Cap, or the named ClusterCap if namespace is empty
+func (app *App) ReferencesCap(name, namespace string) bool {
+	if namespace == "" {
+		return app.Spec.ClusterCapRef != nil && app.Spec.ClusterCapRef.Name == name
+	}
+	return app.Spec.CapRef != nil && app.Spec.CapRef.Name == name && app.Spec.CapRef.Namespace == namespace
+}
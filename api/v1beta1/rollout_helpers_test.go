@@ -0,0 +1,57 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRevisionHashIgnoresLiveSettings(t *testing.T) {
+	spec := CapSpec{Version: "1.0.0", Inputs: CapInputs{{Key: "name", Type: StringInputType}}}
+	base, err := spec.RevisionHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := map[string]func(*CapSpec){
+		"rollout":            func(s *CapSpec) { s.Rollout = &RolloutPolicy{Strategy: BatchRolloutStrategy} },
+		"suspend":            func(s *CapSpec) { s.Suspend = true },
+		"targetNamespaces":   func(s *CapSpec) { s.TargetNamespaces = []string{"monitoring"} },
+		"serviceAccountName": func(s *CapSpec) { s.ServiceAccountName = "deployer" },
+		"catalog":            func(s *CapSpec) { s.Catalog = &CapCatalog{DisplayName: "Web"} },
+		"consumers":          func(s *CapSpec) { s.Consumers = &CapConsumers{Namespaces: []string{"team-*"}} },
+		"maxAppsPerNamespace": func(s *CapSpec) {
+			max := int32(2)
+			s.MaxAppsPerNamespace = &max
+		},
+	}
+	for name, set := range live {
+		changed := spec
+		set(&changed)
+		if hash, _ := changed.RevisionHash(); hash != base {
+			t.Errorf("changing %s must not change the revision hash", name)
+		}
+	}
+
+	changed := spec
+	changed.Version = "1.1.0"
+	if hash, _ := changed.RevisionHash(); hash == base {
+		t.Errorf("changing the version must change the revision hash")
+	}
+}
+
+func TestUseRevisionSpec(t *testing.T) {
+	cap := Cap{Spec: CapSpec{
+		Version:            "2.0.0",
+		Suspend:            true,
+		TargetNamespaces:   []string{"monitoring"},
+		ServiceAccountName: "deployer",
+	}}
+	cap.UseRevisionSpec(CapSpec{Version: "1.0.0", TargetNamespaces: []string{"kube-system"}})
+
+	if cap.Spec.Version != "1.0.0" {
+		t.Errorf("version = %s, want the revision's", cap.Spec.Version)
+	}
+	if !cap.Spec.Suspend || !reflect.DeepEqual(cap.Spec.TargetNamespaces, []string{"monitoring"}) || cap.Spec.ServiceAccountName != "deployer" {
+		t.Errorf("live settings were not kept: %+v", cap.Spec)
+	}
+}
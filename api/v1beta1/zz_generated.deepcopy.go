@@ -23,6 +23,7 @@ package v1beta1
 import (
 	"encoding/json"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -32,7 +33,7 @@ func (in *App) DeepCopyInto(out *App) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new App.
@@ -53,6 +54,22 @@ func (in *App) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppCondition) DeepCopyInto(out *AppCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppCondition.
+func (in *AppCondition) DeepCopy() *AppCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(AppCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppList) DeepCopyInto(out *AppList) {
 	*out = *in
@@ -85,6 +102,62 @@ func (in *AppList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppObjectConflict) DeepCopyInto(out *AppObjectConflict) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppObjectConflict.
+func (in *AppObjectConflict) DeepCopy() *AppObjectConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(AppObjectConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppObjectDrift) DeepCopyInto(out *AppObjectDrift) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppObjectDrift.
+func (in *AppObjectDrift) DeepCopy() *AppObjectDrift {
+	if in == nil {
+		return nil
+	}
+	out := new(AppObjectDrift)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRevision) DeepCopyInto(out *AppRevision) {
+	*out = *in
+	in.Created.DeepCopyInto(&out.Created)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRevision.
+func (in *AppRevision) DeepCopy() *AppRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppSpec) DeepCopyInto(out *AppSpec) {
 	*out = *in
@@ -103,6 +176,21 @@ func (in *AppSpec) DeepCopyInto(out *AppSpec) {
 		*out = make(json.RawMessage, len(*in))
 		copy(*out, *in)
 	}
+	if in.DriftPolicy != nil {
+		in, out := &in.DriftPolicy, &out.DriftPolicy
+		*out = new(DriftPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Revision != nil {
+		in, out := &in.Revision, &out.Revision
+		*out = new(int64)
+		**out = **in
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppSpec.
@@ -118,6 +206,48 @@ func (in *AppSpec) DeepCopy() *AppSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppStatus) DeepCopyInto(out *AppStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]AppCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conflicts != nil {
+		in, out := &in.Conflicts, &out.Conflicts
+		*out = make([]AppObjectConflict, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]AppObjectDrift, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]AppRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppStatus.
@@ -136,7 +266,7 @@ func (in *Cap) DeepCopyInto(out *Cap) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Cap.
@@ -157,6 +287,63 @@ func (in *Cap) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapCatalog) DeepCopyInto(out *CapCatalog) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Maintainers != nil {
+		in, out := &in.Maintainers, &out.Maintainers
+		*out = make([]CapMaintainer, len(*in))
+		copy(*out, *in)
+	}
+	if in.Examples != nil {
+		in, out := &in.Examples, &out.Examples
+		*out = make([]CapExample, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapCatalog.
+func (in *CapCatalog) DeepCopy() *CapCatalog {
+	if in == nil {
+		return nil
+	}
+	out := new(CapCatalog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapConsumers) DeepCopyInto(out *CapConsumers) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapConsumers.
+func (in *CapConsumers) DeepCopy() *CapConsumers {
+	if in == nil {
+		return nil
+	}
+	out := new(CapConsumers)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CapDep) DeepCopyInto(out *CapDep) {
 	*out = *in
@@ -252,6 +439,26 @@ func (in *CapDepStatus) DeepCopy() *CapDepStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapExample) DeepCopyInto(out *CapExample) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(json.RawMessage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapExample.
+func (in *CapExample) DeepCopy() *CapExample {
+	if in == nil {
+		return nil
+	}
+	out := new(CapExample)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CapInput) DeepCopyInto(out *CapInput) {
 	*out = *in
@@ -318,6 +525,196 @@ func (in *CapList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapMaintainer) DeepCopyInto(out *CapMaintainer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapMaintainer.
+func (in *CapMaintainer) DeepCopy() *CapMaintainer {
+	if in == nil {
+		return nil
+	}
+	out := new(CapMaintainer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapOutput) DeepCopyInto(out *CapOutput) {
+	*out = *in
+	out.Object = in.Object
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapOutput.
+func (in *CapOutput) DeepCopy() *CapOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(CapOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapOutputObjectRef) DeepCopyInto(out *CapOutputObjectRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapOutputObjectRef.
+func (in *CapOutputObjectRef) DeepCopy() *CapOutputObjectRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CapOutputObjectRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapPolicy) DeepCopyInto(out *CapPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapPolicy.
+func (in *CapPolicy) DeepCopy() *CapPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CapPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CapPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapPolicyList) DeepCopyInto(out *CapPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CapPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapPolicyList.
+func (in *CapPolicyList) DeepCopy() *CapPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(CapPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CapPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapPolicySpec) DeepCopyInto(out *CapPolicySpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedKinds != nil {
+		in, out := &in.AllowedKinds, &out.AllowedKinds
+		*out = make([]KindSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedKinds != nil {
+		in, out := &in.DeniedKinds, &out.DeniedKinds
+		*out = make([]KindSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedNamespaces != nil {
+		in, out := &in.DeniedNamespaces, &out.DeniedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]FieldRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapPolicySpec.
+func (in *CapPolicySpec) DeepCopy() *CapPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CapPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapRevision) DeepCopyInto(out *CapRevision) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapRevision.
+func (in *CapRevision) DeepCopy() *CapRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(CapRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapRollout) DeepCopyInto(out *CapRollout) {
+	*out = *in
+	if in.UpdatedApps != nil {
+		in, out := &in.UpdatedApps, &out.UpdatedApps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastStep != nil {
+		in, out := &in.LastStep, &out.LastStep
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapRollout.
+func (in *CapRollout) DeepCopy() *CapRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(CapRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CapSource) DeepCopyInto(out *CapSource) {
 	*out = *in
@@ -358,6 +755,48 @@ func (in *CapSpec) DeepCopyInto(out *CapSpec) {
 		*out = make([]v1.ObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]CapOutput, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForceOwnership != nil {
+		in, out := &in.ForceOwnership, &out.ForceOwnership
+		*out = make([]FieldSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DriftPolicy != nil {
+		in, out := &in.DriftPolicy, &out.DriftPolicy
+		*out = new(DriftPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TargetNamespaces != nil {
+		in, out := &in.TargetNamespaces, &out.TargetNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = new(CapConsumers)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxAppsPerNamespace != nil {
+		in, out := &in.MaxAppsPerNamespace, &out.MaxAppsPerNamespace
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Catalog != nil {
+		in, out := &in.Catalog, &out.Catalog
+		*out = new(CapCatalog)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapSpec.
@@ -373,6 +812,26 @@ func (in *CapSpec) DeepCopy() *CapSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CapStatus) DeepCopyInto(out *CapStatus) {
 	*out = *in
+	if in.Revisions != nil {
+		in, out := &in.Revisions, &out.Revisions
+		*out = make([]CapRevision, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(CapRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PolicyViolations != nil {
+		in, out := &in.PolicyViolations, &out.PolicyViolations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = new(CapUsage)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapStatus.
@@ -385,13 +844,42 @@ func (in *CapStatus) DeepCopy() *CapStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapUsage) DeepCopyInto(out *CapUsage) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]NamespaceUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapUsage.
+func (in *CapUsage) DeepCopy() *CapUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(CapUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCap) DeepCopyInto(out *ClusterCap) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCap.
@@ -474,11 +962,123 @@ func (in *ClusterCapStatus) DeepCopy() *ClusterCapStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftPolicy) DeepCopyInto(out *DriftPolicy) {
+	*out = *in
+	if in.Ignore != nil {
+		in, out := &in.Ignore, &out.Ignore
+		*out = make([]FieldSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftPolicy.
+func (in *DriftPolicy) DeepCopy() *DriftPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldRule) DeepCopyInto(out *FieldRule) {
+	*out = *in
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]KindSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldRule.
+func (in *FieldRule) DeepCopy() *FieldRule {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldSelector) DeepCopyInto(out *FieldSelector) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldSelector.
+func (in *FieldSelector) DeepCopy() *FieldSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KindSelector) DeepCopyInto(out *KindSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KindSelector.
+func (in *KindSelector) DeepCopy() *KindSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KindSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceUsage) DeepCopyInto(out *NamespaceUsage) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceUsage.
+func (in *NamespaceUsage) DeepCopy() *NamespaceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RepoAuth) DeepCopyInto(out *RepoAuth) {
 	*out = *in
-	in.Username.DeepCopyInto(&out.Username)
-	in.Password.DeepCopyInto(&out.Password)
+	if in.Username != nil {
+		in, out := &in.Username, &out.Username
+		*out = new(v1.EnvVarSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(v1.EnvVarSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHRepoAuth)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepoAuth.
@@ -506,3 +1106,38 @@ func (in *RepoSpec) DeepCopy() *RepoSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutPolicy) DeepCopyInto(out *RolloutPolicy) {
+	*out = *in
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutPolicy.
+func (in *RolloutPolicy) DeepCopy() *RolloutPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHRepoAuth) DeepCopyInto(out *SSHRepoAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHRepoAuth.
+func (in *SSHRepoAuth) DeepCopy() *SSHRepoAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHRepoAuth)
+	in.DeepCopyInto(out)
+	return out
+}
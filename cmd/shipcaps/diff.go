@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var files repeatedFlag
+	fs.Var(&files, "f", "A file or directory holding the modified Cap or ClusterCap. Repeatable.")
+	var appFiles repeatedFlag
+	fs.Var(&appFiles, "apps", "A file or directory to read Apps from, instead of listing them from the cluster. Repeatable.")
+	var oldFiles repeatedFlag
+	fs.Var(&oldFiles, "old", "A file or directory holding the current Cap or ClusterCap and everything the Apps reference, "+
+		"instead of reading them from the cluster. Repeatable.")
+	namespace := fs.String("n", "default", "The namespace of objects that don't specify one.")
+	contextLines := fs.Int("context", 3, "The number of context lines of the diff.")
+	clusterCapNamespace := fs.String("clustercap-auth-namespace", "shipcaps-system", "The namespace to read repo credentials and revisions of ClusterCaps from.")
+	_ = fs.Parse(args)
+	if len(files) == 0 {
+		return fmt.Errorf("the modified cap is required (-f)")
+	}
+
+	objs, err := loadFiles(files, *namespace)
+	if err != nil {
+		return err
+	}
+	var modified runtime.Object
+	for _, obj := range objs {
+		switch obj.Object.(type) {
+		case *shipcapsv1beta1.Cap, *shipcapsv1beta1.ClusterCap:
+			modified = obj.Object
+		}
+		if modified != nil {
+			break
+		}
+	}
+	if modified == nil {
+		return fmt.Errorf("no cap found in the given files")
+	}
+
+	// Read the current state from files if given, or the cluster otherwise.
+	var c client.Client
+	if len(oldFiles) > 0 {
+		oldObjs, err := loadFiles(append(oldFiles, appFiles...), *namespace)
+		if err != nil {
+			return err
+		}
+		c = fakeClient(oldObjs)
+	} else {
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return err
+		}
+		c, err = client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return err
+		}
+	}
+
+	var apps []shipcapsv1beta1.App
+	if len(appFiles) > 0 {
+		appObjs, err := loadFiles(appFiles, *namespace)
+		if err != nil {
+			return err
+		}
+		for _, obj := range appObjs {
+			if app, ok := obj.Object.(*shipcapsv1beta1.App); ok {
+				apps = append(apps, *app)
+			}
+		}
+	} else {
+		var list shipcapsv1beta1.AppList
+		if err := c.List(context.Background(), &list); err != nil {
+			return err
+		}
+		apps = list.Items
+	}
+
+	diffs, err := diffCap(context.Background(), c, modified, apps, *clusterCapNamespace)
+	if err != nil {
+		return err
+	}
+	return writeDiffs(os.Stdout, diffs, *contextLines)
+}
+
+// AppDiff holds the differences of the objects rendered for an App, before and after a Cap modification
+type AppDiff struct {
+	// App is the namespace/name of the App
+	App string
+
+	// Objects are the differing objects, sorted by their key
+	Objects []ObjectDiff
+
+	// Err holds the reason the App could not be rendered
+	Err error
+}
+
+// ObjectDiff holds the rendered YAML of an object before and after a Cap modification. Old is empty for added
+// objects, New for pruned ones.
+type ObjectDiff struct {
+	Key string
+	Old string
+	New string
+}
+
+// diffCap renders all Apps referencing the modified Cap or ClusterCap, once with the current Cap as read from the
+// given client, and once with the modified Cap, and returns the differences per App.
+func diffCap(ctx context.Context, c client.Client, modified runtime.Object, apps []shipcapsv1beta1.App, clusterCapNamespace string) ([]AppDiff, error) {
+	overlay := &capOverlay{Client: c}
+	switch typed := modified.(type) {
+	case *shipcapsv1beta1.Cap:
+		overlay.cap = typed
+	case *shipcapsv1beta1.ClusterCap:
+		cap := shipcapsv1beta1.Cap(*typed)
+		overlay.cap = &cap
+		overlay.cluster = true
+	default:
+		return nil, fmt.Errorf("%T is no cap", modified)
+	}
+
+	var diffs []AppDiff
+	for i := range apps {
+		app := &apps[i]
+		if !app.ReferencesCap(overlay.cap.Name, overlay.cap.Namespace) {
+			continue
+		}
+		diff := AppDiff{App: app.AppKey()}
+		diffs = append(diffs, diff)
+
+		old, err := renderApp(ctx, c, clusterCapNamespace, app)
+		if err != nil {
+			diffs[len(diffs)-1].Err = fmt.Errorf("unable to render with current cap: %w", err)
+			continue
+		}
+		new, err := renderApp(ctx, overlay, clusterCapNamespace, app)
+		if err != nil {
+			diffs[len(diffs)-1].Err = fmt.Errorf("unable to render with modified cap: %w", err)
+			continue
+		}
+		diffs[len(diffs)-1].Objects, err = diffObjects(append(old.Dependencies, old.Objects...), append(new.Dependencies, new.Objects...))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return diffs, nil
+}
+
+// diffObjects matches the old and new objects by apiVersion, kind, namespace and name, and returns those that differ
+func diffObjects(old, new []map[string]interface{}) ([]ObjectDiff, error) {
+	byKey := make(map[string]*ObjectDiff)
+	for i, objs := range [][]map[string]interface{}{old, new} {
+		for _, content := range objs {
+			obj := unstructured.Unstructured{Object: content}
+			key := fmt.Sprintf("%s %s", obj.GroupVersionKind().GroupKind().String(), obj.GetName())
+			if obj.GetNamespace() != "" {
+				key = fmt.Sprintf("%s %s/%s", obj.GroupVersionKind().GroupKind().String(), obj.GetNamespace(), obj.GetName())
+			}
+			data, err := yaml.Marshal(content)
+			if err != nil {
+				return nil, err
+			}
+			diff, ok := byKey[key]
+			if !ok {
+				diff = &ObjectDiff{Key: key}
+				byKey[key] = diff
+			}
+			if i == 0 {
+				diff.Old = string(data)
+			} else {
+				diff.New = string(data)
+			}
+		}
+	}
+
+	var diffs []ObjectDiff
+	for _, diff := range byKey {
+		if diff.Old != diff.New {
+			diffs = append(diffs, *diff)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs, nil
+}
+
+func writeDiffs(w io.Writer, diffs []AppDiff, contextLines int) error {
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintln(w, "No app references the cap.")
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Fprintf(w, "# App: %s\n", diff.App)
+		if diff.Err != nil {
+			fmt.Fprintf(w, "# error: %s\n", diff.Err)
+			continue
+		}
+		if len(diff.Objects) == 0 {
+			fmt.Fprintln(w, "# no changes")
+			continue
+		}
+		for _, obj := range diff.Objects {
+			oldName, newName := "a/"+obj.Key, "b/"+obj.Key
+			switch {
+			case obj.Old == "":
+				oldName = "/dev/null"
+			case obj.New == "":
+				newName = "/dev/null"
+				fmt.Fprintf(w, "# %s would be pruned\n", obj.Key)
+			}
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+			if _, err := io.WriteString(w, unifiedDiff(obj.Old, obj.New, contextLines)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unifiedDiff returns the hunks of a line-based unified diff between a and b
+func unifiedDiff(a, b string, contextLines int) string {
+	aLines, bLines := splitLines(a), splitLines(b)
+
+	// Longest common subsequence of lines, from the end
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// Edit script, each line prefixed with ' ', '-' or '+'
+	var ops []string
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			ops = append(ops, " "+aLines[i])
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Removed lines go before added ones, like diff(1) shows them
+			ops = append(ops, "-"+aLines[i])
+			i++
+		default:
+			ops = append(ops, "+"+bLines[j])
+			j++
+		}
+	}
+
+	// Group the changes into hunks with context
+	var out strings.Builder
+	aLine, bLine := 1, 1
+	for start := 0; start < len(ops); {
+		if ops[start][0] == ' ' {
+			start++
+			aLine++
+			bLine++
+			continue
+		}
+		from := start - contextLines
+		if from < 0 {
+			from = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end][0] != ' ' {
+				end++
+				continue
+			}
+			// Look ahead whether the next change is close enough to be part of this hunk
+			next := end
+			for next < len(ops) && ops[next][0] == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				break
+			}
+			end = next
+		}
+		to := end + contextLines
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		aStart, bStart := aLine-(start-from), bLine-(start-from)
+		aCount, bCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op[0] != '+' {
+				aCount++
+			}
+			if op[0] != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range ops[from:to] {
+			out.WriteString(op + "\n")
+		}
+
+		for _, op := range ops[start:to] {
+			if op[0] != '+' {
+				aLine++
+			}
+			if op[0] != '-' {
+				bLine++
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// capOverlay serves a modified Cap (or ClusterCap) instead of the one of the same name from the underlying client
+type capOverlay struct {
+	client.Client
+	cap     *shipcapsv1beta1.Cap
+	cluster bool
+}
+
+// Get returns the modified Cap if it is requested, and delegates to the underlying client otherwise
+func (c *capOverlay) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	switch typed := obj.(type) {
+	case *shipcapsv1beta1.Cap:
+		if !c.cluster && key.Name == c.cap.Name && key.Namespace == c.cap.Namespace {
+			c.cap.DeepCopyInto(typed)
+			return nil
+		}
+	case *shipcapsv1beta1.ClusterCap:
+		if c.cluster && key.Name == c.cap.Name {
+			cap := shipcapsv1beta1.ClusterCap(*c.cap.DeepCopy())
+			cap.DeepCopyInto(typed)
+			return nil
+		}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
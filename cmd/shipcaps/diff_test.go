@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+func TestDiffCap(t *testing.T) {
+	objs, err := loadFiles([]string{"testdata/diff/current.yaml"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cap *shipcapsv1beta1.Cap
+	var clusterCap *shipcapsv1beta1.ClusterCap
+	var apps []shipcapsv1beta1.App
+	for _, obj := range objs {
+		switch typed := obj.Object.(type) {
+		case *shipcapsv1beta1.Cap:
+			cap = typed
+		case *shipcapsv1beta1.ClusterCap:
+			clusterCap = typed
+		case *shipcapsv1beta1.App:
+			apps = append(apps, *typed)
+		}
+	}
+
+	// The modification changes the ConfigMap, drops the Secret and adds a Service.
+	inline := json.RawMessage(`[
+		{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"{{ name }}"},"data":{"color":"green"}},
+		{"apiVersion":"v1","kind":"Service","metadata":{"name":"{{ name }}"}}
+	]`)
+	modifiedCap := cap.DeepCopy()
+	modifiedCap.Spec.Source.InLine = inline
+	modifiedClusterCap := clusterCap.DeepCopy()
+	modifiedClusterCap.Spec.Source.InLine = inline
+
+	tests := []struct {
+		name     string
+		modified runtime.Object
+		app      string
+		prefix   string
+	}{
+		{name: "cap", modified: modifiedCap, app: "default/web", prefix: "web"},
+		{name: "clustercap", modified: modifiedClusterCap, app: "default/shared", prefix: "shared"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := diffCap(context.Background(), fakeClient(objs), tt.modified, apps, "shipcaps-system")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only the App referencing the modified cap is diffed.
+			if len(diffs) != 1 || diffs[0].App != tt.app || diffs[0].Err != nil {
+				t.Fatalf("diffCap() = %+v, want a single diff for app %s", diffs, tt.app)
+			}
+
+			type change struct{ key, kind string }
+			var got []change
+			for _, obj := range diffs[0].Objects {
+				kind := "changed"
+				switch {
+				case obj.Old == "":
+					kind = "added"
+				case obj.New == "":
+					kind = "pruned"
+				}
+				got = append(got, change{obj.Key, kind})
+			}
+			want := []change{
+				{"ConfigMap default/" + tt.prefix, "changed"},
+				{"Secret default/" + tt.prefix + "-legacy", "pruned"},
+				{"Service default/" + tt.prefix, "added"},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("diffCap() objects = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		a, b         string
+		contextLines int
+		want         string
+	}{
+		{name: "equal", a: "a\nb\n", b: "a\nb\n", contextLines: 3, want: ""},
+		{name: "added object", a: "", b: "a\nb\n", contextLines: 3, want: "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{name: "pruned object", a: "a\n", b: "", contextLines: 3, want: "@@ -1 +0,0 @@\n-a\n"},
+		{
+			name:         "context trimmed",
+			a:            "1\n2\n3\n4\n5\n6\n7\n",
+			b:            "1\n2\n3\nx\n5\n6\n7\n",
+			contextLines: 1,
+			want:         "@@ -3,3 +3,3 @@\n 3\n-4\n+x\n 5\n",
+		},
+		{
+			name:         "close changes merged",
+			a:            "1\n2\n3\n4\n5\n6\n7\n",
+			b:            "x\n2\n3\n4\ny\n6\n7\n",
+			contextLines: 2,
+			want:         "@@ -1,7 +1,7 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n 6\n 7\n",
+		},
+		{
+			name:         "distant changes split",
+			a:            "1\n2\n3\n4\n5\n6\n7\n",
+			b:            "x\n2\n3\n4\n5\n6\ny\n",
+			contextLines: 1,
+			want:         "@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.a, tt.b, tt.contextLines); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{start: 1, count: 0, want: "0,0"},
+		{start: 4, count: 1, want: "4"},
+		{start: 4, count: 3, want: "4,3"},
+	}
+
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %s, want %s", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redradrat/shipcaps/controllers"
+)
+
+func runInventory(args []string) error {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	var files repeatedFlag
+	fs.Var(&files, "f", "A file or directory to read Apps and everything they reference from, instead of the cluster. Repeatable.")
+	namespace := fs.String("n", "", "The namespace of the Apps to list. All namespaces if empty.")
+	capName := fs.String("cap", "", "List only Apps of the Cap with this namespace/name, or the ClusterCap with this name.")
+	selector := fs.String("l", "", "List only Apps matching this label selector.")
+	output := fs.String("o", "json", "The output format: json or csv.")
+	clusterCapNamespace := fs.String("clustercap-auth-namespace", "shipcaps-system", "The namespace to read repo credentials and revisions of ClusterCaps from.")
+	_ = fs.Parse(args)
+
+	filter := controllers.InventoryFilter{Namespace: *namespace, Cap: *capName}
+	if *selector != "" {
+		parsed, err := labels.Parse(*selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector: %w", err)
+		}
+		filter.Selector = parsed
+	}
+
+	// Read everything from files if given, or the cluster otherwise.
+	var c client.Client
+	if len(files) > 0 {
+		defaultNamespace := *namespace
+		if defaultNamespace == "" {
+			defaultNamespace = "default"
+		}
+		objs, err := loadFiles(files, defaultNamespace)
+		if err != nil {
+			return err
+		}
+		c = fakeClient(objs)
+	} else {
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return err
+		}
+		c, err = client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return err
+		}
+	}
+
+	r := controllers.AppReconciler{
+		Client:                  c,
+		Log:                     ctrl.Log.WithName("inventory"),
+		Scheme:                  scheme,
+		ClusterCapAuthNamespace: *clusterCapNamespace,
+	}
+	inventory, err := r.Inventory(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(inventory)
+	case "csv":
+		return inventory.WriteCSV(os.Stdout)
+	default:
+		return fmt.Errorf("unknown output format '%s'", *output)
+	}
+}
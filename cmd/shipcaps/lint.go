@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+// Severity is the severity of a lint finding
+type Severity string
+
+const (
+	// ErrorSeverity findings make the Cap fail to render or apply
+	ErrorSeverity Severity = "error"
+	// WarningSeverity findings are most likely mistakes, but don't break the Cap
+	WarningSeverity Severity = "warning"
+)
+
+// lintRule describes a check of the linter
+type lintRule struct {
+	ID          string
+	Severity    Severity
+	Description string
+}
+
+var lintRules = []lintRule{
+	{ID: "invalid-source", Severity: ErrorSeverity, Description: "The source type and source don't fit together."},
+	{ID: "invalid-values", Severity: ErrorSeverity, Description: "The values can't be parsed."},
+	{ID: "invalid-manifest", Severity: ErrorSeverity, Description: "An inline manifest is missing apiVersion, kind or metadata.name."},
+	{ID: "undeclared-placeholder", Severity: ErrorSeverity, Description: "A placeholder references a targetId that no input or value declares."},
+	{ID: "duplicate-key", Severity: ErrorSeverity, Description: "Two inputs have the same key."},
+	{ID: "duplicate-target", Severity: ErrorSeverity, Description: "Two inputs or values have the same targetId."},
+	{ID: "unresolved-dependency", Severity: ErrorSeverity, Description: "A dependency references a CapDep that is not part of the given files."},
+	{ID: "unused-input", Severity: WarningSeverity, Description: "An input is never referenced by a placeholder."},
+	{ID: "placeholder-in-list", Severity: WarningSeverity, Description: "A placeholder inside a list, which is not replaced."},
+}
+
+// Finding is a single problem found by the linter
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Message  string   `json:"message"`
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	var files repeatedFlag
+	fs.Var(&files, "f", "A file or directory to read Caps, ClusterCaps and CapDeps from. Repeatable.")
+	namespace := fs.String("n", "default", "The namespace of objects that don't specify one.")
+	output := fs.String("o", "text", "The output format: text, json or sarif.")
+	_ = fs.Parse(args)
+	if len(files) == 0 {
+		return fmt.Errorf("at least one file is required (-f)")
+	}
+
+	objs, err := loadFiles(files, *namespace)
+	if err != nil {
+		return err
+	}
+	return writeFindings(os.Stdout, lint(objs), *output)
+}
+
+// writeFindings writes the findings in the given output format, and fails if any of them is an error
+func writeFindings(w io.Writer, findings []Finding, output string) error {
+	switch output {
+	case "text":
+		writeFindingsText(w, findings)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []Finding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	case "sarif":
+		if err := writeFindingsSARIF(w, findings); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format '%s'", output)
+	}
+
+	for _, f := range findings {
+		if f.Severity == ErrorSeverity {
+			return fmt.Errorf("lint found errors")
+		}
+	}
+	return nil
+}
+
+// lint checks all Caps, ClusterCaps and CapDeps of the given objects
+func lint(objs []loadedObject) []Finding {
+	capDeps := make(map[string]bool)
+	for _, obj := range objs {
+		if dep, ok := obj.Object.(*shipcapsv1beta1.CapDep); ok {
+			capDeps[dep.Namespace+"/"+dep.Name] = true
+		}
+	}
+
+	var findings []Finding
+	for _, obj := range objs {
+		var l *linter
+		switch typed := obj.Object.(type) {
+		case *shipcapsv1beta1.Cap:
+			l = &linter{file: obj.File, kind: "Cap", name: typed.Name}
+			l.lintCap(typed.Spec, capDeps)
+		case *shipcapsv1beta1.ClusterCap:
+			l = &linter{file: obj.File, kind: "ClusterCap", name: typed.Name}
+			l.lintCap(typed.Spec, capDeps)
+		case *shipcapsv1beta1.CapDep:
+			l = &linter{file: obj.File, kind: "CapDep", name: typed.Name}
+			l.lintSource(typed.Spec.Source, nil, typed.Spec.Values)
+		default:
+			continue
+		}
+		findings = append(findings, l.findings...)
+	}
+	return findings
+}
+
+// linter collects the findings of a single object
+type linter struct {
+	file     string
+	kind     string
+	name     string
+	findings []Finding
+}
+
+func (l *linter) report(rule string, format string, a ...interface{}) {
+	severity := ErrorSeverity
+	for _, r := range lintRules {
+		if r.ID == rule {
+			severity = r.Severity
+		}
+	}
+	l.findings = append(l.findings, Finding{
+		Rule:     rule,
+		Severity: severity,
+		File:     l.file,
+		Kind:     l.kind,
+		Name:     l.name,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) lintCap(spec shipcapsv1beta1.CapSpec, capDeps map[string]bool) {
+	keys := make(map[string]bool)
+	for _, in := range spec.Inputs {
+		if keys[in.Key] {
+			l.report("duplicate-key", "input key '%s' is declared more than once", in.Key)
+		}
+		keys[in.Key] = true
+	}
+	for _, dep := range spec.Dependencies {
+		if !capDeps[dep.Namespace+"/"+dep.Name] {
+			l.report("unresolved-dependency", "dependency '%s/%s' does not resolve to a CapDep", dep.Namespace, dep.Name)
+		}
+	}
+	l.lintSource(spec.Source, spec.Inputs, spec.Values)
+}
+
+// lintSource checks the source against the targetIds declared by the given inputs and values
+func (l *linter) lintSource(src shipcapsv1beta1.CapSource, inputs shipcapsv1beta1.CapInputs, values json.RawMessage) {
+	if err := src.Check(); err != nil {
+		l.report("invalid-source", "%s", err)
+		return
+	}
+
+	targets := make(map[parsing.TargetIdentifier]bool)
+	declare := func(id parsing.TargetIdentifier) {
+		if targets[id] {
+			l.report("duplicate-target", "targetId '%s' is declared more than once", id)
+		}
+		targets[id] = true
+	}
+	for _, in := range inputs {
+		if in.TargetIdentifier != "" {
+			declare(in.TargetIdentifier)
+		}
+	}
+	cvs, err := parsing.ParseRawCapValues(parsing.RawCapValues(values))
+	if err != nil {
+		l.report("invalid-values", "%s", err)
+	}
+	for _, v := range cvs {
+		declare(v.TargetIdentifier)
+	}
+
+	// Placeholders can only be checked for inline manifests, as helm charts use the targetIds as value paths, and
+	// repos are not checked out.
+	if src.Type != shipcapsv1beta1.SimpleCapSourceType || !src.IsInLine() {
+		return
+	}
+	var manifests []map[string]interface{}
+	if err := json.Unmarshal(src.InLine, &manifests); err != nil {
+		l.report("invalid-manifest", "inline manifests are not a list of objects: %s", err)
+		return
+	}
+
+	used := make(map[parsing.TargetIdentifier]bool)
+	for i, manifest := range manifests {
+		obj := unstructured.Unstructured{Object: manifest}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			l.report("invalid-manifest", "inline manifest %d is missing apiVersion, kind or metadata.name", i)
+		}
+		desc := fmt.Sprintf("%s '%s'", obj.GetKind(), obj.GetName())
+		for _, ph := range collectPlaceholders(manifest, "", false) {
+			used[ph.id] = true
+			if ph.inList {
+				l.report("placeholder-in-list", "placeholder '%s' at %s of %s is inside a list, and won't be replaced", ph.id, ph.path, desc)
+			}
+			if !targets[ph.id] {
+				l.report("undeclared-placeholder", "placeholder '%s' at %s of %s references an undeclared targetId", ph.id, ph.path, desc)
+			}
+		}
+	}
+	for _, in := range inputs {
+		if in.TargetIdentifier == "" {
+			l.report("unused-input", "input '%s' has no targetId", in.Key)
+		} else if !used[in.TargetIdentifier] {
+			l.report("unused-input", "input '%s' is never used, as no placeholder references targetId '%s'", in.Key, in.TargetIdentifier)
+		}
+	}
+}
+
+// placeholder is a placeholder found in a manifest
+type placeholder struct {
+	id     parsing.TargetIdentifier
+	path   string
+	inList bool
+}
+
+// collectPlaceholders returns all placeholders of the given value, sorted by path
+func collectPlaceholders(value interface{}, path string, inList bool) []placeholder {
+	var out []placeholder
+	switch typed := value.(type) {
+	case string:
+		if id, ok := shipcapsv1beta1.IsFullPlaceholder(typed); ok {
+			out = append(out, placeholder{id: parsing.TargetIdentifier(id), path: path, inList: inList})
+		} else if phs, ok := shipcapsv1beta1.IsStringPlaceholders(typed); ok {
+			for _, ph := range phs {
+				if id, ok := shipcapsv1beta1.IsFullPlaceholder(ph); ok {
+					out = append(out, placeholder{id: parsing.TargetIdentifier(id), path: path, inList: inList})
+				}
+			}
+		}
+	case map[string]interface{}:
+		for key, v := range typed {
+			out = append(out, collectPlaceholders(v, path+"."+key, inList)...)
+		}
+	case []interface{}:
+		for i, v := range typed {
+			out = append(out, collectPlaceholders(v, fmt.Sprintf("%s[%d]", path, i), true)...)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].path < out[j].path
+	})
+	return out
+}
+
+func writeFindingsText(w io.Writer, findings []Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s: %s: %s '%s': %s [%s]\n", f.File, f.Severity, f.Kind, f.Name, f.Message, f.Rule)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found.")
+	}
+}
+
+// writeFindingsSARIF writes the findings as SARIF 2.1.0 log, as understood by most CI systems
+func writeFindingsSARIF(w io.Writer, findings []Finding) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID                   string  `json:"id"`
+		ShortDescription     message `json:"shortDescription"`
+		DefaultConfiguration struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+	type artifactLocation struct {
+		URI string `json:"uri"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation artifactLocation `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	var rules []rule
+	for _, r := range lintRules {
+		sr := rule{ID: r.ID, ShortDescription: message{Text: r.Description}}
+		sr.DefaultConfiguration.Level = string(r.Severity)
+		rules = append(rules, sr)
+	}
+	results := []result{}
+	for _, f := range findings {
+		loc := location{}
+		loc.PhysicalLocation.ArtifactLocation.URI = f.File
+		results = append(results, result{
+			RuleID:    f.Rule,
+			Level:     string(f.Severity),
+			Message:   message{Text: fmt.Sprintf("%s '%s': %s", f.Kind, f.Name, f.Message)},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":  "shipcaps lint",
+						"rules": rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// lintFixture lints the given fixture file, and writes the findings in the given output format
+func lintFixture(t *testing.T, file, output string) ([]byte, error) {
+	t.Helper()
+	objs, err := loadFiles([]string{file}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = writeFindings(&buf, lint(objs), output)
+	return buf.Bytes(), err
+}
+
+func TestLintOutputGolden(t *testing.T) {
+	tests := []struct {
+		file   string
+		output string
+		golden string
+	}{
+		{file: "findings.yaml", output: "text", golden: "findings.txt"},
+		{file: "findings.yaml", output: "json", golden: "findings.json"},
+		{file: "findings.yaml", output: "sarif", golden: "findings.sarif"},
+		{file: "warnings.yaml", output: "json", golden: "warnings.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, _ := lintFixture(t, filepath.Join("testdata", "lint", tt.file), tt.output)
+			golden := filepath.Join("testdata", "lint", tt.golden)
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestLintSARIF(t *testing.T) {
+	out, _ := lintFixture(t, "testdata/lint/findings.yaml", "sarif")
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("SARIF log has version %q and %d runs, want 2.1.0 and 1", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(lintRules) {
+		t.Errorf("SARIF log describes %d rules, want %d", len(run.Tool.Driver.Rules), len(lintRules))
+	}
+
+	type result struct{ ruleID, level, uri string }
+	var got []result
+	for _, r := range run.Results {
+		if len(r.Locations) != 1 {
+			t.Fatalf("result %s has %d locations, want 1", r.RuleID, len(r.Locations))
+		}
+		got = append(got, result{r.RuleID, r.Level, r.Locations[0].PhysicalLocation.ArtifactLocation.URI})
+	}
+	want := []result{
+		{"undeclared-placeholder", "error", "testdata/lint/findings.yaml"},
+		{"unused-input", "warning", "testdata/lint/findings.yaml"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SARIF results = %v, want %v", got, want)
+	}
+}
+
+func TestLintExitStatus(t *testing.T) {
+	tests := []struct {
+		file    string
+		output  string
+		wantErr bool
+	}{
+		{file: "findings.yaml", output: "text", wantErr: true},
+		{file: "findings.yaml", output: "json", wantErr: true},
+		{file: "findings.yaml", output: "sarif", wantErr: true},
+		{file: "warnings.yaml", output: "sarif"},
+		{file: "warnings.yaml", output: "yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.output, func(t *testing.T) {
+			_, err := lintFixture(t, filepath.Join("testdata", "lint", tt.file), tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeFindings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// loadedObject is an object read from a file
+type loadedObject struct {
+	// File is the file the object was read from
+	File string
+
+	// Object is the typed object, if its kind is known, or the unstructured object otherwise
+	Object runtime.Object
+}
+
+// loadFiles reads all objects from the given files, and from the YAML and JSON files in the given directories.
+// Objects without a namespace are put into the given namespace, unless they are ClusterCaps.
+func loadFiles(paths []string, namespace string) ([]loadedObject, error) {
+	files, err := listFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []loadedObject
+	for _, file := range files {
+		fileObjs, err := loadFile(file, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s': %w", file, err)
+		}
+		objs = append(objs, fileObjs...)
+	}
+	return objs, nil
+}
+
+// listFiles returns the given files, and the YAML and JSON files in the given directories
+func listFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(file)
+			if !info.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// loadFile reads all objects of a single, possibly multi-document file
+func loadFile(file string, namespace string) ([]loadedObject, error) {
+	contents, err := decodeFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []loadedObject
+	for _, content := range contents {
+		u := unstructured.Unstructured{Object: content}
+		gvk := u.GroupVersionKind()
+		if gvk.Kind == "" {
+			return nil, fmt.Errorf("object '%s' has no kind", u.GetName())
+		}
+		if u.GetNamespace() == "" && gvk.Kind != "ClusterCap" {
+			u.SetNamespace(namespace)
+		}
+		if !scheme.Recognizes(gvk) {
+			objs = append(objs, loadedObject{File: file, Object: &u})
+			continue
+		}
+
+		// Convert via JSON, as raw values are not supported by the unstructured converter.
+		typed, err := scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(u.Object)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, typed); err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %w", gvk.Kind, u.GetName(), err)
+		}
+		objs = append(objs, loadedObject{File: file, Object: typed})
+	}
+	return objs, nil
+}
+
+// decodeFile decodes all documents of a single YAML or JSON file, skipping empty ones
+func decodeFile(file string) ([]map[string]interface{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var contents []map[string]interface{}
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		content := map[string]interface{}{}
+		if err := decoder.Decode(&content); err != nil {
+			if err == io.EOF {
+				return contents, nil
+			}
+			return nil, err
+		}
+		if len(content) != 0 {
+			contents = append(contents, content)
+		}
+	}
+}
+
+// fakeClient returns a client that serves the given objects, as if they existed in a cluster
+func fakeClient(objs []loadedObject) client.Client {
+	var runtimeObjs []runtime.Object
+	for _, obj := range objs {
+		if _, ok := obj.Object.(*unstructured.Unstructured); ok {
+			continue
+		}
+		runtimeObjs = append(runtimeObjs, obj.Object)
+	}
+	return fake.NewFakeClientWithScheme(scheme, runtimeObjs...)
+}
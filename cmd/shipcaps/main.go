@@ -0,0 +1,92 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command shipcaps is a tool for Cap authors, that works with Cap, ClusterCap, CapDep and App files on disk.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	helmv1 "github.com/fluxcd/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = helmv1.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+}
+
+// command is a subcommand of the shipcaps tool
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "render", summary: "Render Apps from files, without a cluster", run: runRender},
+	{name: "lint", summary: "Check Caps, ClusterCaps and CapDeps for mistakes", run: runLint},
+	{name: "diff", summary: "Show how a modified Cap changes the objects of its Apps", run: runDiff},
+	{name: "inventory", summary: "List Apps with their Cap, values and objects", run: runInventory},
+	{name: "scaffold-helm", summary: "Generate a Cap from a Helm chart's values", run: runScaffoldHelm},
+	{name: "scaffold-manifests", summary: "Generate a Cap from a directory of manifests", run: runScaffoldManifests},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: shipcaps <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'shipcaps <command> -h' for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+// repeatedFlag collects the values of a repeatable flag, like -f
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
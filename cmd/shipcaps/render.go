@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/controllers"
+)
+
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	var files repeatedFlag
+	fs.Var(&files, "f", "A file or directory to read Caps, ClusterCaps, CapDeps, Apps, Secrets and ConfigMaps from. Repeatable.")
+	namespace := fs.String("n", "default", "The namespace of objects that don't specify one.")
+	appName := fs.String("app", "", "The name of the App to render. All Apps are rendered if empty.")
+	clusterCapNamespace := fs.String("clustercap-auth-namespace", "shipcaps-system", "The namespace to read repo credentials of ClusterCaps from.")
+	_ = fs.Parse(args)
+	if len(files) == 0 {
+		return fmt.Errorf("at least one file is required (-f)")
+	}
+
+	objs, err := loadFiles(files, *namespace)
+	if err != nil {
+		return err
+	}
+	c := fakeClient(objs)
+
+	var apps []*shipcapsv1beta1.App
+	for _, obj := range objs {
+		if app, ok := obj.Object.(*shipcapsv1beta1.App); ok && (*appName == "" || app.Name == *appName) {
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 {
+		return fmt.Errorf("no app found to render")
+	}
+
+	for _, app := range apps {
+		render, err := renderApp(context.Background(), c, *clusterCapNamespace, app)
+		if err != nil {
+			return fmt.Errorf("unable to render app '%s/%s': %w", app.Namespace, app.Name, err)
+		}
+		fmt.Fprintf(os.Stdout, "# App: %s/%s\n", app.Namespace, app.Name)
+		if err := writeManifests(os.Stdout, append(render.Dependencies, render.Objects...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderApp renders the given App exactly like the controller would, with the objects served by the given client
+func renderApp(ctx context.Context, c client.Client, clusterCapNamespace string, app *shipcapsv1beta1.App) (*controllers.AppRender, error) {
+	r := controllers.AppReconciler{
+		Client:                  c,
+		Log:                     ctrl.Log.WithName("render"),
+		Scheme:                  scheme,
+		ClusterCapAuthNamespace: clusterCapNamespace,
+		// The namespace policy is up to the operator, so don't enforce one when rendering locally.
+		AllowedTargetNamespaces: []string{controllers.AnyNamespace},
+	}
+	return r.Render(ctx, app)
+}
+
+// writeManifests writes the given objects as multi-document YAML
+func writeManifests(w io.Writer, objs []map[string]interface{}) error {
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
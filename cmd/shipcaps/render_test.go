@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/controllers"
+)
+
+// renderFixture renders the App of the given name from the given fixture file
+func renderFixture(t *testing.T, file, appName string) *controllers.AppRender {
+	t.Helper()
+	objs, err := loadFiles([]string{file}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objs {
+		if app, ok := obj.Object.(*shipcapsv1beta1.App); ok && app.Name == appName {
+			render, err := renderApp(context.Background(), fakeClient(objs), "shipcaps-system", app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return render
+		}
+	}
+	t.Fatalf("no app '%s' in %s", appName, file)
+	return nil
+}
+
+func TestRenderSimpleCap(t *testing.T) {
+	render := renderFixture(t, "testdata/render/simple.yaml", "web")
+	if len(render.Objects) != 2 {
+		t.Fatalf("rendered %d objects, want 2", len(render.Objects))
+	}
+
+	configMap := unstructured.Unstructured{Object: render.Objects[0]}
+	if configMap.GetName() != "web" || configMap.GetNamespace() != "default" {
+		t.Errorf("ConfigMap rendered as %s/%s", configMap.GetNamespace(), configMap.GetName())
+	}
+	data, _, _ := unstructured.NestedStringMap(configMap.Object, "data")
+	// The color is read from a ConfigMap, and the version is a value of the Cap.
+	if want := map[string]string{"version": "v1", "color": "blue"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("ConfigMap data = %v, want %v", data, want)
+	}
+
+	secret := unstructured.Unstructured{Object: render.Objects[1]}
+	password, _, _ := unstructured.NestedString(secret.Object, "stringData", "password")
+	if secret.GetName() != "web-credentials" || password != "s3cr3t" {
+		t.Errorf("Secret %s rendered with password %q, want it read from the Secret", secret.GetName(), password)
+	}
+}
+
+func TestRenderHelmChartCap(t *testing.T) {
+	render := renderFixture(t, "testdata/render/helmchart.yaml", "cache")
+	if len(render.Objects) != 1 {
+		t.Fatalf("rendered %d objects, want 1", len(render.Objects))
+	}
+
+	release := unstructured.Unstructured{Object: render.Objects[0]}
+	if release.GetKind() != "HelmRelease" || release.GetName() != "cache" || release.GetNamespace() != "default" {
+		t.Errorf("rendered %s %s/%s, want HelmRelease default/cache", release.GetKind(), release.GetNamespace(), release.GetName())
+	}
+	chart, _, _ := unstructured.NestedStringMap(release.Object, "spec", "chart")
+	if want := map[string]string{"git": "https://github.com/example/charts.git", "ref": "main", "path": "charts/redis"}; !reflect.DeepEqual(chart, want) {
+		t.Errorf("chart = %v, want %v", chart, want)
+	}
+	values, _, _ := unstructured.NestedMap(release.Object, "spec", "values")
+	want := map[string]interface{}{
+		"replica": map[string]interface{}{"count": int64(3)},
+		"image":   map[string]interface{}{"tag": "6.0"},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+}
+
+func TestRenderMissingValueSource(t *testing.T) {
+	objs, err := loadFiles([]string{"testdata/render/simple.yaml"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave out the Secret the password is read from.
+	var kept []loadedObject
+	var app *shipcapsv1beta1.App
+	for _, obj := range objs {
+		if u, ok := obj.Object.(interface{ GetName() string }); ok && u.GetName() == "web-password" {
+			continue
+		}
+		if a, ok := obj.Object.(*shipcapsv1beta1.App); ok {
+			app = a
+		}
+		kept = append(kept, obj)
+	}
+
+	if _, err := renderApp(context.Background(), fakeClient(kept), "shipcaps-system", app); err == nil {
+		t.Errorf("renderApp() should fail without the Secret a value is read from")
+	}
+}
+
+func TestWriteManifests(t *testing.T) {
+	var buf bytes.Buffer
+	objs := []map[string]interface{}{
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "a"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "b"}},
+	}
+	if err := writeManifests(&buf, objs); err != nil {
+		t.Fatal(err)
+	}
+	if docs := strings.Count(buf.String(), "---\n"); docs != 2 {
+		t.Errorf("wrote %d documents, want 2:\n%s", docs, buf.String())
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func runScaffoldHelm(args []string) error {
+	fs := flag.NewFlagSet("scaffold-helm", flag.ExitOnError)
+	chart := fs.String("chart", "", "The chart directory, holding Chart.yaml and values.yaml.")
+	var inputs repeatedFlag
+	fs.Var(&inputs, "input", "A values path to turn into an input, as path[=key][:type], e.g. service.type=serviceType. Repeatable.")
+	name := fs.String("name", "", "The name of the Cap. Defaults to the chart name.")
+	namespace := fs.String("n", "", "The namespace of the Cap.")
+	cluster := fs.Bool("cluster", false, "Generate a ClusterCap instead of a Cap.")
+	repo := fs.String("repo", "", "The URI of the git repository holding the chart.")
+	ref := fs.String("ref", "master", "The git ref to check the chart out at.")
+	path := fs.String("path", "", "The path of the chart within the repository. Defaults to the chart name.")
+	_ = fs.Parse(args)
+	if *chart == "" {
+		return fmt.Errorf("the chart directory is required (-chart)")
+	}
+	if *repo == "" {
+		return fmt.Errorf("the chart repository is required (-repo)")
+	}
+
+	meta := struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}{}
+	if err := readYAMLFile(filepath.Join(*chart, "Chart.yaml"), &meta); err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	if err := readYAMLFile(filepath.Join(*chart, "values.yaml"), &values); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var schema map[string]interface{}
+	if err := readYAMLFile(filepath.Join(*chart, "values.schema.json"), &schema); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	spec, err := scaffoldHelmSpec(values, schema, inputs)
+	if err != nil {
+		return err
+	}
+	spec.Version = meta.Version
+	spec.Source.Repo = shipcapsv1beta1.RepoSpec{URI: *repo, Ref: *ref, Path: *path}
+	if spec.Source.Repo.Path == "" {
+		spec.Source.Repo.Path = meta.Name
+	}
+	if *name == "" {
+		*name = meta.Name
+	}
+
+	return writeScaffold(scaffoldCap(*name, *namespace, *cluster, spec))
+}
+
+// scaffoldHelmSpec returns the spec of a helmchart Cap for a chart with the given values and schema. The selected
+// paths become inputs, all other values of the chart become values of the Cap.
+func scaffoldHelmSpec(values, schema map[string]interface{}, selected []string) (shipcapsv1beta1.CapSpec, error) {
+	spec := shipcapsv1beta1.CapSpec{
+		Source: shipcapsv1beta1.CapSource{Type: shipcapsv1beta1.HelmChartCapSourceType},
+	}
+
+	leaves := make(map[string]interface{})
+	collectLeaves(values, "", leaves)
+
+	taken := make(map[string]bool)
+	for _, sel := range selected {
+		path, key, typ := parseInputFlag(sel)
+		def := lookupValue(values, path)
+		if _, isMap := def.(map[string]interface{}); isMap {
+			return spec, fmt.Errorf("input '%s' is not a single value, but a map of values", path)
+		}
+		if typ == "" {
+			var err error
+			if typ, err = inferInputType(path, def, schemaAt(schema, path)); err != nil {
+				return spec, err
+			}
+		}
+		spec.Inputs = append(spec.Inputs, shipcapsv1beta1.CapInput{
+			Key:              key,
+			Type:             typ,
+			Optional:         def != nil && !schemaRequires(schema, path),
+			TargetIdentifier: parsing.TargetIdentifier(path),
+		})
+		taken[path] = true
+	}
+
+	var capValues []parsing.CapValue
+	for path, value := range leaves {
+		if taken[path] {
+			continue
+		}
+		capValues = append(capValues, parsing.CapValue{Value: value, TargetIdentifier: parsing.TargetIdentifier(path)})
+	}
+	sort.Slice(capValues, func(i, j int) bool {
+		return capValues[i].TargetIdentifier < capValues[j].TargetIdentifier
+	})
+	if len(capValues) > 0 {
+		raw, err := json.Marshal(capValues)
+		if err != nil {
+			return spec, err
+		}
+		spec.Values = raw
+	}
+
+	return spec, nil
+}
+
+// parseInputFlag splits an input flag of the form path[=key][:type]. The key defaults to the path in lower camel case.
+func parseInputFlag(flag string) (path, key string, typ shipcapsv1beta1.ValueType) {
+	if i := strings.LastIndex(flag, ":"); i >= 0 {
+		flag, typ = flag[:i], shipcapsv1beta1.ValueType(flag[i+1:])
+	}
+	path = flag
+	if i := strings.Index(flag, "="); i >= 0 {
+		path, key = flag[:i], flag[i+1:]
+	}
+	if key == "" {
+		key = inputKey(path)
+	}
+	return path, key, typ
+}
+
+// inputKey turns a dotted path into a lower camel case key, e.g. service.ingress-class into serviceIngressClass
+func inputKey(path string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range path {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// collectLeaves flattens the given values into dotted paths. Nulls and empty maps are skipped, as there is nothing to
+// set, just like keys holding a dot, which can't be expressed as targetId.
+func collectLeaves(value interface{}, path string, out map[string]interface{}) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		if value != nil {
+			out[path] = value
+		}
+		return
+	}
+	for key, v := range m {
+		if strings.Contains(key, ".") {
+			fmt.Fprintf(os.Stderr, "Warning: skipping '%s', as its key contains a dot\n", strings.TrimPrefix(path+"."+key, "."))
+			continue
+		}
+		collectLeaves(v, strings.TrimPrefix(path+"."+key, "."), out)
+	}
+}
+
+// lookupValue returns the value at the given dotted path, or nil if there is none
+func lookupValue(values map[string]interface{}, path string) interface{} {
+	var current interface{} = values
+	for _, seg := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[seg]
+	}
+	return current
+}
+
+// schemaAt returns the JSON schema of the value at the given dotted path, or nil if the schema doesn't describe it
+func schemaAt(schema map[string]interface{}, path string) map[string]interface{} {
+	current := schema
+	for _, seg := range strings.Split(path, ".") {
+		props, _ := current["properties"].(map[string]interface{})
+		current, _ = props[seg].(map[string]interface{})
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// schemaRequires tells whether the JSON schema marks the value at the given dotted path as required
+func schemaRequires(schema map[string]interface{}, path string) bool {
+	parent := schema
+	last := path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent, last = schemaAt(schema, path[:i]), path[i+1:]
+	}
+	required, _ := parent["required"].([]interface{})
+	for _, r := range required {
+		if r == last {
+			return true
+		}
+	}
+	return false
+}
+
+// inferInputType derives the type of an input from the JSON schema of its value, or the default value if there is no
+// schema
+func inferInputType(path string, def interface{}, schema map[string]interface{}) (shipcapsv1beta1.ValueType, error) {
+	if schema != nil {
+		typ, _ := schema["type"].(string)
+		items, _ := schema["items"].(map[string]interface{})
+		switch {
+		case typ == "string":
+			return shipcapsv1beta1.StringInputType, nil
+		case typ == "integer":
+			return shipcapsv1beta1.IntInputType, nil
+		case typ == "number":
+			return shipcapsv1beta1.FloatInputType, nil
+		case typ == "array" && items != nil && items["type"] == "string":
+			return shipcapsv1beta1.StringListInputType, nil
+		case typ != "":
+			return "", fmt.Errorf("input '%s' is of schema type '%s', which no input type supports", path, typ)
+		}
+	}
+
+	switch typed := def.(type) {
+	case string:
+		return shipcapsv1beta1.StringInputType, nil
+	case float64:
+		if typed == float64(int64(typed)) {
+			return shipcapsv1beta1.IntInputType, nil
+		}
+		return shipcapsv1beta1.FloatInputType, nil
+	case []interface{}:
+		for _, item := range typed {
+			if _, ok := item.(string); !ok {
+				return "", fmt.Errorf("input '%s' is a list of other than strings, which no input type supports", path)
+			}
+		}
+		return shipcapsv1beta1.StringListInputType, nil
+	case nil:
+		return "", fmt.Errorf("the type of input '%s' can't be inferred, as it has no default; specify it as %s:<type>", path, path)
+	default:
+		return "", fmt.Errorf("input '%s' is of type %T, which no input type supports", path, def)
+	}
+}
+
+// scaffoldCap returns a Cap, or ClusterCap, with the given spec
+func scaffoldCap(name, namespace string, cluster bool, spec shipcapsv1beta1.CapSpec) runtime.Object {
+	if cluster {
+		return &shipcapsv1beta1.ClusterCap{
+			TypeMeta:   v1.TypeMeta{APIVersion: shipcapsv1beta1.GroupVersion.String(), Kind: "ClusterCap"},
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       spec,
+		}
+	}
+	return &shipcapsv1beta1.Cap{
+		TypeMeta:   v1.TypeMeta{APIVersion: shipcapsv1beta1.GroupVersion.String(), Kind: "Cap"},
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       spec,
+	}
+}
+
+// writeScaffold writes the given objects as multi-document YAML to stdout, leaving out everything that is not set
+func writeScaffold(objs ...runtime.Object) error {
+	for _, obj := range objs {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(content, "status")
+		spec, _, _ := unstructured.NestedMap(content, "spec")
+		for key, value := range spec {
+			if value == nil {
+				unstructured.RemoveNestedField(content, "spec", key)
+			}
+		}
+		if auth, _, _ := unstructured.NestedMap(content, "spec", "source", "repo", "auth"); len(auth) == 0 {
+			unstructured.RemoveNestedField(content, "spec", "source", "repo", "auth")
+		}
+		if uri, _, _ := unstructured.NestedString(content, "spec", "source", "repo", "uri"); uri == "" {
+			unstructured.RemoveNestedField(content, "spec", "source", "repo")
+		}
+		data, err := yaml.Marshal(content)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, "---")
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readYAMLFile decodes the given YAML (or JSON) file into out
+func readYAMLFile(path string, out interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestInferInputType(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     interface{}
+		schema  map[string]interface{}
+		want    shipcapsv1beta1.ValueType
+		wantErr bool
+	}{
+		{name: "string", def: "ClusterIP", want: shipcapsv1beta1.StringInputType},
+		{name: "int", def: float64(3), want: shipcapsv1beta1.IntInputType},
+		{name: "float", def: 0.5, want: shipcapsv1beta1.FloatInputType},
+		{name: "string list", def: []interface{}{"a", "b"}, want: shipcapsv1beta1.StringListInputType},
+		{name: "empty list", def: []interface{}{}, want: shipcapsv1beta1.StringListInputType},
+		{name: "list of maps", def: []interface{}{map[string]interface{}{}}, wantErr: true},
+		{name: "bool", def: true, wantErr: true},
+		{name: "no default", wantErr: true},
+		{name: "schema integer", def: 0.5, schema: map[string]interface{}{"type": "integer"}, want: shipcapsv1beta1.IntInputType},
+		{name: "schema number", def: float64(3), schema: map[string]interface{}{"type": "number"}, want: shipcapsv1beta1.FloatInputType},
+		{name: "schema string", schema: map[string]interface{}{"type": "string"}, want: shipcapsv1beta1.StringInputType},
+		{
+			name:   "schema string list",
+			schema: map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			want:   shipcapsv1beta1.StringListInputType,
+		},
+		{name: "schema object", schema: map[string]interface{}{"type": "object"}, wantErr: true},
+		{name: "schema without type", def: "a", schema: map[string]interface{}{"description": "a"}, want: shipcapsv1beta1.StringInputType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inferInputType("value", tt.def, tt.schema)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inferInputType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("inferInputType() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaffoldHelmSpec(t *testing.T) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(`
+replicaCount: 1
+image:
+  repository: nginx
+  tag: "1.19"
+service:
+  type: ClusterIP
+  port: 80
+resources: {}
+nodeSelector:
+ratio: 0.5
+`), &values); err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{
+		"required": []interface{}{"replicaCount"},
+		"properties": map[string]interface{}{
+			"replicaCount": map[string]interface{}{"type": "integer"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		selected   []string
+		wantInputs shipcapsv1beta1.CapInputs
+		wantValues []parsing.TargetIdentifier
+		wantErr    bool
+	}{
+		{
+			name:       "no inputs",
+			wantValues: []parsing.TargetIdentifier{"image.repository", "image.tag", "ratio", "replicaCount", "service.port", "service.type"},
+		},
+		{
+			name:     "inferred inputs",
+			selected: []string{"replicaCount", "ratio", "service.port", "service.type=kind"},
+			wantInputs: shipcapsv1beta1.CapInputs{
+				{Key: "replicaCount", Type: shipcapsv1beta1.IntInputType, TargetIdentifier: "replicaCount"},
+				{Key: "ratio", Type: shipcapsv1beta1.FloatInputType, Optional: true, TargetIdentifier: "ratio"},
+				{Key: "servicePort", Type: shipcapsv1beta1.IntInputType, Optional: true, TargetIdentifier: "service.port"},
+				{Key: "kind", Type: shipcapsv1beta1.StringInputType, Optional: true, TargetIdentifier: "service.type"},
+			},
+			wantValues: []parsing.TargetIdentifier{"image.repository", "image.tag"},
+		},
+		{
+			name:     "typed input without default",
+			selected: []string{"ingress.host=host:string"},
+			wantInputs: shipcapsv1beta1.CapInputs{
+				{Key: "host", Type: shipcapsv1beta1.StringInputType, TargetIdentifier: "ingress.host"},
+			},
+			wantValues: []parsing.TargetIdentifier{"image.repository", "image.tag", "ratio", "replicaCount", "service.port", "service.type"},
+		},
+		{name: "untyped input without default", selected: []string{"ingress.host"}, wantErr: true},
+		{name: "map input", selected: []string{"image"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := scaffoldHelmSpec(values, schema, tt.selected)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scaffoldHelmSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if spec.Source.Type != shipcapsv1beta1.HelmChartCapSourceType {
+				t.Errorf("scaffoldHelmSpec() source type = %s, want %s", spec.Source.Type, shipcapsv1beta1.HelmChartCapSourceType)
+			}
+			if !reflect.DeepEqual(spec.Inputs, tt.wantInputs) {
+				t.Errorf("scaffoldHelmSpec() inputs = %+v, want %+v", spec.Inputs, tt.wantInputs)
+			}
+			var capValues []parsing.CapValue
+			if err := json.Unmarshal(spec.Values, &capValues); err != nil {
+				t.Fatal(err)
+			}
+			var targets []parsing.TargetIdentifier
+			for _, v := range capValues {
+				targets = append(targets, v.TargetIdentifier)
+			}
+			if !reflect.DeepEqual(targets, tt.wantValues) {
+				t.Errorf("scaffoldHelmSpec() value targetIds = %v, want %v", targets, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestParseInputFlag(t *testing.T) {
+	tests := []struct {
+		flag string
+		path string
+		key  string
+		typ  shipcapsv1beta1.ValueType
+	}{
+		{flag: "replicaCount", path: "replicaCount", key: "replicaCount"},
+		{flag: "service.ingress-class", path: "service.ingress-class", key: "serviceIngressClass"},
+		{flag: "service.type=kind", path: "service.type", key: "kind"},
+		{flag: "service.port:int", path: "service.port", key: "servicePort", typ: shipcapsv1beta1.IntInputType},
+		{flag: "service.port=port:float", path: "service.port", key: "port", typ: shipcapsv1beta1.FloatInputType},
+	}
+
+	for _, tt := range tests {
+		path, key, typ := parseInputFlag(tt.flag)
+		if path != tt.path || key != tt.key || typ != tt.typ {
+			t.Errorf("parseInputFlag(%s) = %s, %s, %s, want %s, %s, %s", tt.flag, path, key, typ, tt.path, tt.key, tt.typ)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+// manifestParam marks a field of the manifests to be replaced by an input
+type manifestParam struct {
+	// Kind limits the param to manifests of this kind
+	Kind string `json:"kind,omitempty"`
+
+	// Name limits the param to manifests of this name
+	Name string `json:"name,omitempty"`
+
+	// Path is the JSONPath of the field, e.g. {.spec.replicas}
+	Path string `json:"path"`
+
+	// Key is the key of the input. Defaults to the last field of the path.
+	Key string `json:"key,omitempty"`
+
+	// Type is the type of the input. Defaults to the type of the field's current value.
+	Type shipcapsv1beta1.ValueType `json:"type,omitempty"`
+}
+
+// manifestMapping is the content of a mapping file
+type manifestMapping struct {
+	Params []manifestParam `json:"params"`
+}
+
+func runScaffoldManifests(args []string) error {
+	fs := flag.NewFlagSet("scaffold-manifests", flag.ExitOnError)
+	var files repeatedFlag
+	fs.Var(&files, "f", "A file or directory to read manifests from. Repeatable.")
+	var params repeatedFlag
+	fs.Var(&params, "param", "A field to turn into an input, as [Kind[/name]]{.json.path}[=key][:type], "+
+		"e.g. Deployment{.spec.replicas}=replicas. Repeatable.")
+	mapping := fs.String("mapping", "", "A YAML file listing the fields to turn into inputs, as params with kind, name, path, key and type.")
+	name := fs.String("name", "", "The name of the Cap.")
+	namespace := fs.String("n", "default", "The namespace of the Cap and the example App.")
+	cluster := fs.Bool("cluster", false, "Generate a ClusterCap instead of a Cap.")
+	_ = fs.Parse(args)
+	if len(files) == 0 {
+		return fmt.Errorf("at least one file is required (-f)")
+	}
+	if *name == "" {
+		return fmt.Errorf("the name of the cap is required (-name)")
+	}
+
+	var all []manifestParam
+	if *mapping != "" {
+		var m manifestMapping
+		if err := readYAMLFile(*mapping, &m); err != nil {
+			return err
+		}
+		all = append(all, m.Params...)
+	}
+	for _, p := range params {
+		param, err := parseParamFlag(p)
+		if err != nil {
+			return err
+		}
+		all = append(all, param)
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("no fields to turn into inputs (-param or -mapping)")
+	}
+
+	paths, err := listFiles(files)
+	if err != nil {
+		return err
+	}
+	var manifests []map[string]interface{}
+	for _, path := range paths {
+		contents, err := decodeFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read '%s': %w", path, err)
+		}
+		manifests = append(manifests, contents...)
+	}
+
+	spec, values, err := scaffoldManifestsSpec(manifests, all)
+	if err != nil {
+		return err
+	}
+
+	capNamespace := *namespace
+	app := shipcapsv1beta1.App{
+		TypeMeta:   metav1.TypeMeta{APIVersion: shipcapsv1beta1.GroupVersion.String(), Kind: "App"},
+		ObjectMeta: metav1.ObjectMeta{Name: *name, Namespace: *namespace},
+	}
+	if *cluster {
+		capNamespace = ""
+		app.Spec.ClusterCapRef = &v1.ObjectReference{Name: *name}
+	} else {
+		app.Spec.CapRef = &v1.ObjectReference{Name: *name, Namespace: *namespace}
+	}
+	if app.Spec.Values, err = json.Marshal(values); err != nil {
+		return err
+	}
+
+	return writeScaffold(scaffoldCap(*name, capNamespace, *cluster, spec), &app)
+}
+
+// scaffoldManifestsSpec replaces the fields marked by the given params with placeholders, and returns the spec of a
+// simple Cap with the manifests inline, along with App values that render the original manifests again.
+func scaffoldManifestsSpec(manifests []map[string]interface{}, params []manifestParam) (shipcapsv1beta1.CapSpec, parsing.AppValues, error) {
+	spec := shipcapsv1beta1.CapSpec{
+		Source: shipcapsv1beta1.CapSource{Type: shipcapsv1beta1.SimpleCapSourceType},
+	}
+	var values parsing.AppValues
+
+	inputs := make(map[string]int)
+	for _, param := range params {
+		fields, err := parseJSONPath(param.Path)
+		if err != nil {
+			return spec, nil, err
+		}
+		paramKey := param.Key
+		if paramKey == "" {
+			paramKey = inputKey(fields[len(fields)-1])
+		}
+
+		matched := false
+		for _, manifest := range manifests {
+			obj := unstructured.Unstructured{Object: manifest}
+			if (param.Kind != "" && obj.GetKind() != param.Kind) || (param.Name != "" && obj.GetName() != param.Name) {
+				continue
+			}
+			value, found, err := unstructured.NestedFieldNoCopy(manifest, fields...)
+			if err != nil || !found {
+				continue
+			}
+			matched = true
+
+			typ := param.Type
+			if typ == "" {
+				if typ, err = inferInputType(param.Path, value, nil); err != nil {
+					return spec, nil, err
+				}
+			}
+			key := paramKey
+			if i, ok := inputs[key]; ok && param.Key == "" && !reflect.DeepEqual(values[i].Value, value) {
+				// A derived key can't keep fields of different values, so tell them apart by the manifest's name
+				key = inputKey(obj.GetName() + "." + paramKey)
+			}
+			if i, ok := inputs[key]; ok {
+				if spec.Inputs[i].Type != typ {
+					return spec, nil, fmt.Errorf("input '%s' is used for fields of type %s and %s", key, spec.Inputs[i].Type, typ)
+				}
+				if !reflect.DeepEqual(values[i].Value, value) {
+					return spec, nil, fmt.Errorf("input '%s' is used for fields with the values %v and %v, which the example App "+
+						"can't both set", key, values[i].Value, value)
+				}
+			} else {
+				inputs[key] = len(spec.Inputs)
+				spec.Inputs = append(spec.Inputs, shipcapsv1beta1.CapInput{
+					Key:              key,
+					Type:             typ,
+					TargetIdentifier: parsing.TargetIdentifier(key),
+				})
+				values = append(values, parsing.AppValue{Key: key, Value: value})
+			}
+
+			if err := unstructured.SetNestedField(manifest, fmt.Sprintf("{{ %s }}", key), fields...); err != nil {
+				return spec, nil, err
+			}
+		}
+		if !matched {
+			return spec, nil, fmt.Errorf("%s matches no field of the manifests", param.Path)
+		}
+	}
+
+	raw, err := json.Marshal(manifests)
+	if err != nil {
+		return spec, nil, err
+	}
+	spec.Source.InLine = raw
+	return spec, values, nil
+}
+
+// parseParamFlag parses a param flag of the form [Kind[/name]]{.json.path}[=key][:type]
+func parseParamFlag(flag string) (manifestParam, error) {
+	open, end := strings.Index(flag, "{"), strings.Index(flag, "}")
+	if open < 0 || end < open {
+		return manifestParam{}, fmt.Errorf("param '%s' has no JSONPath in braces", flag)
+	}
+	param := manifestParam{Path: flag[open : end+1]}
+	param.Kind = flag[:open]
+	if i := strings.Index(param.Kind, "/"); i >= 0 {
+		param.Kind, param.Name = param.Kind[:i], param.Kind[i+1:]
+	}
+
+	rest := flag[end+1:]
+	if i := strings.Index(rest, ":"); i >= 0 {
+		rest, param.Type = rest[:i], shipcapsv1beta1.ValueType(rest[i+1:])
+	}
+	if rest != "" && !strings.HasPrefix(rest, "=") {
+		return manifestParam{}, fmt.Errorf("param '%s' has unexpected '%s' after the JSONPath", flag, rest)
+	}
+	param.Key = strings.TrimPrefix(rest, "=")
+	return param, nil
+}
+
+// parseJSONPath splits a JSONPath of fields, like {.metadata.labels['app.kubernetes.io/name']}, into the fields.
+// List indexes and filters are rejected, as placeholders inside lists are not replaced.
+func parseJSONPath(path string) ([]string, error) {
+	p := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+	var fields []string
+	for p != "" {
+		switch {
+		case strings.HasPrefix(p, "['") || strings.HasPrefix(p, `["`):
+			end := strings.Index(p[2:], p[1:2]+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated field name in JSONPath %s", path)
+			}
+			fields = append(fields, p[2:2+end])
+			p = p[2+end+2:]
+		case strings.HasPrefix(p, "["):
+			return nil, fmt.Errorf("JSONPath %s points into a list, but placeholders inside lists are not replaced", path)
+		case strings.HasPrefix(p, "."):
+			p = p[1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			fields = append(fields, p[:end])
+			p = p[end:]
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("JSONPath %s selects no field", path)
+	}
+	return fields, nil
+}
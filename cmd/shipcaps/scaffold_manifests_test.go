@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestScaffoldManifestsSpec(t *testing.T) {
+	deployment := func(name string, replicas float64) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": name, "labels": map[string]interface{}{"app.kubernetes.io/name": name}},
+			"spec":       map[string]interface{}{"replicas": replicas},
+		}
+	}
+	replicas := func(m map[string]interface{}) interface{} {
+		return m["spec"].(map[string]interface{})["replicas"]
+	}
+
+	// Manifests are decoded from YAML, so numbers are float64.
+	tests := []struct {
+		name         string
+		manifests    []map[string]interface{}
+		params       []manifestParam
+		wantInputs   shipcapsv1beta1.CapInputs
+		wantValues   parsing.AppValues
+		wantReplicas []interface{}
+		wantErr      bool
+	}{
+		{
+			name:         "shared value",
+			manifests:    []map[string]interface{}{deployment("web", 2), deployment("worker", 2)},
+			params:       []manifestParam{{Path: "{.spec.replicas}"}},
+			wantInputs:   shipcapsv1beta1.CapInputs{{Key: "replicas", Type: shipcapsv1beta1.IntInputType, TargetIdentifier: "replicas"}},
+			wantValues:   parsing.AppValues{{Key: "replicas", Value: float64(2)}},
+			wantReplicas: []interface{}{"{{ replicas }}", "{{ replicas }}"},
+		},
+		{
+			name:      "different values of a default key",
+			manifests: []map[string]interface{}{deployment("web", 2), deployment("worker", 1)},
+			params:    []manifestParam{{Path: "{.spec.replicas}"}},
+			wantInputs: shipcapsv1beta1.CapInputs{
+				{Key: "replicas", Type: shipcapsv1beta1.IntInputType, TargetIdentifier: "replicas"},
+				{Key: "workerReplicas", Type: shipcapsv1beta1.IntInputType, TargetIdentifier: "workerReplicas"},
+			},
+			wantValues:   parsing.AppValues{{Key: "replicas", Value: float64(2)}, {Key: "workerReplicas", Value: float64(1)}},
+			wantReplicas: []interface{}{"{{ replicas }}", "{{ workerReplicas }}"},
+		},
+		{
+			name:      "different values of an explicit key",
+			manifests: []map[string]interface{}{deployment("web", 2), deployment("worker", 1)},
+			params:    []manifestParam{{Path: "{.spec.replicas}", Key: "replicas"}},
+			wantErr:   true,
+		},
+		{
+			name:         "limited to kind and name",
+			manifests:    []map[string]interface{}{deployment("web", 2), deployment("worker", 1)},
+			params:       []manifestParam{{Kind: "Deployment", Name: "worker", Path: "{.spec.replicas}", Key: "workers", Type: shipcapsv1beta1.StringInputType}},
+			wantInputs:   shipcapsv1beta1.CapInputs{{Key: "workers", Type: shipcapsv1beta1.StringInputType, TargetIdentifier: "workers"}},
+			wantValues:   parsing.AppValues{{Key: "workers", Value: float64(1)}},
+			wantReplicas: []interface{}{float64(2), "{{ workers }}"},
+		},
+		{
+			name:      "key of different types",
+			manifests: []map[string]interface{}{deployment("web", 2)},
+			params:    []manifestParam{{Path: "{.spec.replicas}", Key: "web"}, {Path: "{.metadata.name}", Key: "web"}},
+			wantErr:   true,
+		},
+		{
+			name:      "no matching field",
+			manifests: []map[string]interface{}{deployment("web", 2)},
+			params:    []manifestParam{{Kind: "Service", Path: "{.spec.type}"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid path",
+			manifests: []map[string]interface{}{deployment("web", 2)},
+			params:    []manifestParam{{Path: "{.spec.containers[0].image}"}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, values, err := scaffoldManifestsSpec(tt.manifests, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scaffoldManifestsSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(spec.Inputs, tt.wantInputs) {
+				t.Errorf("scaffoldManifestsSpec() inputs = %+v, want %+v", spec.Inputs, tt.wantInputs)
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("scaffoldManifestsSpec() values = %+v, want %+v", values, tt.wantValues)
+			}
+			var manifests []map[string]interface{}
+			if err := json.Unmarshal(spec.Source.InLine, &manifests); err != nil {
+				t.Fatal(err)
+			}
+			var got []interface{}
+			for _, m := range manifests {
+				got = append(got, replicas(m))
+			}
+			if !reflect.DeepEqual(got, tt.wantReplicas) {
+				t.Errorf("scaffoldManifestsSpec() replicas = %v, want %v", got, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+func TestParseParamFlag(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    manifestParam
+		wantErr bool
+	}{
+		{flag: "{.spec.replicas}", want: manifestParam{Path: "{.spec.replicas}"}},
+		{flag: "Deployment{.spec.replicas}", want: manifestParam{Kind: "Deployment", Path: "{.spec.replicas}"}},
+		{
+			flag: "Deployment/web{.spec.replicas}=replicas:int",
+			want: manifestParam{Kind: "Deployment", Name: "web", Path: "{.spec.replicas}", Key: "replicas", Type: shipcapsv1beta1.IntInputType},
+		},
+		{flag: "{.spec.type}:string", want: manifestParam{Path: "{.spec.type}", Type: shipcapsv1beta1.StringInputType}},
+		{
+			flag: "{.metadata.labels['app.kubernetes.io/name']}=appName",
+			want: manifestParam{Path: "{.metadata.labels['app.kubernetes.io/name']}", Key: "appName"},
+		},
+		{flag: ".spec.replicas", wantErr: true},
+		{flag: "}.spec.replicas{", wantErr: true},
+		{flag: "{.spec.replicas}replicas", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			got, err := parseParamFlag(tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseParamFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseParamFlag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "{.spec.replicas}", want: []string{"spec", "replicas"}},
+		{path: " {.spec.replicas} ", want: []string{"spec", "replicas"}},
+		{path: ".spec.replicas", want: []string{"spec", "replicas"}},
+		{path: "{.metadata.labels['app.kubernetes.io/name']}", want: []string{"metadata", "labels", "app.kubernetes.io/name"}},
+		{path: `{.metadata.annotations["a.b/c"].x}`, want: []string{"metadata", "annotations", "a.b/c", "x"}},
+		{path: "{.metadata.labels['app}", wantErr: true},
+		{path: "{.spec.containers[0].image}", wantErr: true},
+		{path: "{.items[?(@.name=='web')]}", wantErr: true},
+		{path: "{}", wantErr: true},
+		{path: "{.}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
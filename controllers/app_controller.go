@@ -18,20 +18,34 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	helmv1 "github.com/fluxcd/helm-operator/pkg/apis/helm.fluxcd.io/v1"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+	"github.com/redradrat/shipcaps/gitrepo"
 	"github.com/redradrat/shipcaps/parsing"
 )
 
@@ -41,6 +55,36 @@ type AppReconciler struct {
 	Log             logr.Logger
 	Scheme          *runtime.Scheme
 	RequeueDuration time.Duration
+
+	// DependencyRequeueDuration is the interval an App waiting for a CapDep or an output is requeued after.
+	// Defaults to DefaultDependencyRequeueDuration.
+	DependencyRequeueDuration time.Duration
+
+	// ErrorBackoffMin and ErrorBackoffMax bound the exponential backoff an App failing with a transient error is
+	// requeued after. Default to DefaultErrorBackoffMin and DefaultErrorBackoffMax.
+	ErrorBackoffMin time.Duration
+	ErrorBackoffMax time.Duration
+
+	// ClusterCapAuthNamespace is the namespace the repo credentials of ClusterCaps are read from
+	ClusterCapAuthNamespace string
+
+	// Recorder records events for Apps
+	Recorder record.EventRecorder
+
+	// Config is the config the operator connects to the apiserver with. It is required to apply the objects of Apps
+	// as a ServiceAccount.
+	Config *rest.Config
+
+	// RESTMapper tells which rendered objects are namespaced. Optional, built-in kinds are known without it.
+	RESTMapper meta.RESTMapper
+
+	// AllowedTargetNamespaces lists the namespaces other than their own Apps may write objects into. AnyNamespace
+	// allows all. Apps may only write into their own namespace if empty.
+	AllowedTargetNamespaces []string
+
+	backoff       backoff
+	impersonating impersonatingClients
+	checkouts     gitrepo.Cache
 }
 
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=apps,verbs=get;list;watch;create;update;patch;delete
@@ -49,6 +93,11 @@ type AppReconciler struct {
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=caps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capdeps,verbs=get;list;watch
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capdeps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch
 
 func (r *AppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -58,95 +107,450 @@ func (r *AppReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err := r.Get(ctx, req.NamespacedName, &app)
 	if err != nil {
 		log.V(1).Info("unable to fetch App")
-		return ctrl.Result{
-			RequeueAfter: r.RequeueDuration,
-		}, client.IgnoreNotFound(err)
+		if apierrors.IsNotFound(err) {
+			objectsApplied.DeleteLabelValues(req.Namespace, req.Name)
+			objectsPruned.DeleteLabelValues(req.Namespace, req.Name)
+			r.backoff.reset(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	if app.Spec.ClusterCapRef != nil && app.Spec.CapRef != nil {
-		return ctrl.Result{}, fmt.Errorf("both ClusterCapRef and CapRef set")
+	status := app.Status.DeepCopy()
+	ready := app.GetCondition(shipcapsv1beta1.AppReady).DeepCopy()
+	suspended, err := r.reconcileSuspension(ctx, &app)
+	if err == nil && !suspended {
+		err = r.reconcileApp(ctx, &app, log)
 	}
-	if app.Spec.ClusterCapRef == nil && app.Spec.CapRef == nil {
-		return ctrl.Result{}, fmt.Errorf("neither ClusterCapRef nor CapRef set")
+	switch {
+	case suspended:
+		log.V(1).Info("app is suspended")
+	case errors.IsErr(err, parsing.AppOutputNotReadyCode), errors.IsErr(err, shipcapsv1beta1.OutputNotAvailableCode):
+		// We're waiting for another App to publish its outputs, or our own outputs to become available, so this is
+		// not an error on our side.
+		log.V(1).Info("waiting for output", "reason", err.Error())
+		app.SetCondition(shipcapsv1beta1.AppReady, corev1.ConditionFalse, failureReason(err), err.Error())
+		r.event(&app, corev1.EventTypeNormal, failureReason(err), err.Error())
+	case errors.IsErr(err, errors.DependencyNotReadyCode):
+		log.V(1).Info("waiting for dependency", "reason", err.Error())
+		app.SetCondition(shipcapsv1beta1.AppReady, corev1.ConditionFalse, failureReason(err), err.Error())
+		r.event(&app, corev1.EventTypeNormal, failureReason(err), err.Error())
+	case err != nil:
+		app.SetCondition(shipcapsv1beta1.AppReady, corev1.ConditionFalse, failureReason(err), err.Error())
+		r.event(&app, corev1.EventTypeWarning, failureReason(err), err.Error())
+	default:
+		app.SetCondition(shipcapsv1beta1.AppReady, corev1.ConditionTrue, shipcapsv1beta1.ReconciledReason, "")
 	}
+	observeDependencyWait(&app, ready)
+	app.Status.ObservedGeneration = app.Generation
 
-	// Get the referenced ClusterCap
-	var cap shipcapsv1beta1.Cap
-	if app.Spec.ClusterCapRef != nil {
-		clusterCap := shipcapsv1beta1.ClusterCap{}
-		key := client.ObjectKey{
-			Name: app.Spec.ClusterCapRef.Name,
+	// Only write the status if it changed, as every write triggers another reconcile of this App.
+	if !reflect.DeepEqual(status, &app.Status) {
+		if updateErr := r.Status().Update(ctx, &app); updateErr != nil {
+			return ctrl.Result{}, updateErr
 		}
-		err = r.Client.Get(ctx, key, &clusterCap)
+	}
+	return r.requeue(req.NamespacedName, err, log), nil
+}
+
+// requeue returns when to reconcile an App again, after a reconcile that ended with the given error. The error is
+// handled here rather than returned to controller-runtime, which would retry it with its own backoff forever:
+//   - Apps waiting for a CapDep or an output are requeued after DependencyRequeueDuration
+//   - terminal errors are not requeued, as they need a change to the App, its Cap or a value source, which triggers
+//     a reconcile anyway
+//   - transient errors are requeued with an exponential backoff between ErrorBackoffMin and ErrorBackoffMax
+func (r *AppReconciler) requeue(key types.NamespacedName, err error, log logr.Logger) ctrl.Result {
+	switch {
+	case err == nil:
+		r.backoff.reset(key)
+		log.V(1).Info("Successfully Reconciled")
+		return ctrl.Result{RequeueAfter: r.RequeueDuration}
+	case errors.IsErr(err, errors.DependencyNotReadyCode), errors.IsErr(err, errors.AppOutputNotReadyCode),
+		errors.IsErr(err, errors.OutputNotAvailableCode):
+		r.backoff.reset(key)
+		return ctrl.Result{RequeueAfter: durationOrDefault(r.DependencyRequeueDuration, DefaultDependencyRequeueDuration)}
+	case !errors.IsTransient(err):
+		r.backoff.reset(key)
+		log.Info("reconcile failed, waiting for a change", "reason", failureReason(err), "error", err.Error())
+		return ctrl.Result{}
+	default:
+		delay := r.backoff.next(key,
+			durationOrDefault(r.ErrorBackoffMin, DefaultErrorBackoffMin),
+			durationOrDefault(r.ErrorBackoffMax, DefaultErrorBackoffMax))
+		log.Info("reconcile failed, retrying", "reason", failureReason(err), "error", err.Error(), "after", delay)
+		return ctrl.Result{RequeueAfter: delay}
+	}
+}
+
+// reconcileSuspension sets the Suspended condition of the given App, and returns true if the App or its Cap is
+// suspended. The Ready condition is left as is while suspended, so it reflects the last reconcile.
+func (r *AppReconciler) reconcileSuspension(ctx context.Context, app *shipcapsv1beta1.App) (bool, error) {
+	reason := ""
+	if app.IsSuspended() {
+		reason = shipcapsv1beta1.AppSuspendedReason
+	} else {
+		cap, err := r.getCap(ctx, app)
 		if err != nil {
-			return ctrl.Result{}, err
+			return false, errors.Wrap(errors.CapNotFoundCode, err, "").With(errors.Context{App: app.AppKey()})
+		}
+		if cap.IsSuspended() {
+			reason = shipcapsv1beta1.CapSuspendedReason
 		}
-		cap = shipcapsv1beta1.Cap(clusterCap)
 	}
 
-	// Get the referenced Cap
-	if app.Spec.CapRef != nil {
-		key := client.ObjectKey{
-			Namespace: app.Spec.CapRef.Namespace,
-			Name:      app.Spec.CapRef.Name,
+	cond := app.GetCondition(shipcapsv1beta1.AppSuspended)
+	wasSuspended := cond != nil && cond.Status == corev1.ConditionTrue
+	if reason != "" {
+		app.SetCondition(shipcapsv1beta1.AppSuspended, corev1.ConditionTrue, reason, "")
+		if !wasSuspended {
+			r.event(app, corev1.EventTypeNormal, SuspendedEventReason, fmt.Sprintf("Reconciliation suspended (%s)", reason))
 		}
-		err = r.Client.Get(ctx, key, &cap)
-		if err != nil {
-			return ctrl.Result{}, err
+		return true, nil
+	}
+	if cond != nil {
+		app.SetCondition(shipcapsv1beta1.AppSuspended, corev1.ConditionFalse, shipcapsv1beta1.ResumedReason, "")
+		if wasSuspended {
+			r.event(app, corev1.EventTypeNormal, ResumedEventReason, "Reconciliation resumed")
 		}
 	}
+	return false, nil
+}
 
-	// Get the required CapDeps
-	var capdeps []shipcapsv1beta1.CapDep
-	for _, dep := range cap.Spec.Dependencies {
-		capdep := shipcapsv1beta1.CapDep{}
-		err = r.Client.Get(ctx, client.ObjectKey{Name: dep.Name, Namespace: dep.Namespace}, &capdep)
+// reconcileApp renders and applies the dependencies and the Cap of the given App, records the render as revision,
+// and publishes the App's outputs. Apps pinned to a revision apply the stored render of that revision instead.
+func (r *AppReconciler) reconcileApp(ctx context.Context, app *shipcapsv1beta1.App, log logr.Logger) error {
+	cap, err := r.getCap(ctx, app)
+	if err != nil {
+		return errors.Wrap(errors.CapNotFoundCode, err, "").With(errors.Context{App: app.AppKey()})
+	}
+	if err := cap.CheckConsumer(ctx, r.Client, app); err != nil {
+		return err
+	}
+	if err := cap.CheckAppLimit(ctx, r.Client, app); err != nil {
+		return err
+	}
+	// The fields of previous conflicts stay with their managers, and are no drift.
+	conflicts := app.Status.Conflicts
+	app.Status.Conflicts = nil
+	app.Status.Drift = nil
+
+	errCtx := errors.Context{App: app.AppKey(), Cap: cap.CapKey()}
+	capRev, err := r.useCapRevision(ctx, app, &cap)
+	if err != nil {
+		return errors.Wrap(errors.RenderFailedCode, err, "").With(errCtx)
+	}
+
+	var render *AppRender
+	if app.Spec.Revision != nil {
+		render, err = r.loadRevision(ctx, app, *app.Spec.Revision)
 		if err != nil {
-			return ctrl.Result{}, err
+			err = errors.Wrap(errors.RenderFailedCode, err, "").With(errCtx)
+		} else {
+			// The namespace policy and CapPolicies may have changed since the revision was recorded.
+			err = r.checkRender(ctx, app, &cap, render)
+		}
+	} else {
+		start := time.Now()
+		render, err = r.renderApp(ctx, app, &cap)
+		renderDuration.WithLabelValues(cap.KindName()).Observe(time.Since(start).Seconds())
+		if err == nil && capRev != nil {
+			render.CapRevision = capRev.Revision
+		}
+		if err != nil && !errors.IsErr(err, parsing.AppOutputNotReadyCode) {
+			code, ok := errors.CodeOf(err)
+			if !ok {
+				code = "Unknown"
+			}
+			renderFailures.WithLabelValues(cap.KindName(), cap.Namespace, cap.Name, string(code)).Inc()
+			if code == errors.MissingInputCode || code == errors.TypeMismatchCode {
+				inputValidationFailures.WithLabelValues(cap.KindName(), cap.Namespace, cap.Name).Inc()
+			}
 		}
-		capdeps = append(capdeps, capdep)
+	}
+	if err != nil {
+		return err
 	}
 
-	// Reconcile the Dependencies for this App
-	for _, dep := range capdeps {
-		depValues, err := dep.RenderValues()
+	// Dependencies are provided by the cluster admins, so they are always applied with the operator's identity. They are
+	// still rendered into the allowed namespaces and checked against the CapPolicies, like the objects of the App.
+	for _, obj := range render.Dependencies {
+		if err := r.applyRenderedObject(ctx, r.Client, app, obj, ApplyPolicy{Conflicts: conflicts}, log); err != nil {
+			return err
+		}
+	}
+	c, err := r.applyClient(app, &cap)
+	if err != nil {
+		return errors.Wrap(errors.ApplyFailedCode, err, "").With(errCtx)
+	}
+	policy := applyPolicy(app, &cap)
+	policy.Conflicts = conflicts
+	for _, obj := range render.Objects {
+		if err := r.applyRenderedObject(ctx, c, app, obj, policy, log); err != nil {
+			return err
+		}
+	}
+
+	app.Status.CapRevision = render.CapRevision
+	app.Status.CapVersion = render.CapVersion
+	app.Status.Usage = renderUsage(render.Objects)
+
+	if err := r.pruneObjects(ctx, c, app, render); err != nil {
+		return err
+	}
+	if err := r.reconcileRevisions(ctx, app, render); err != nil {
+		return err
+	}
+
+	return r.reconcileOutputs(ctx, app, &cap, render)
+}
+
+// Render renders the given App from the Cap revision it should use, without applying anything. The App doesn't need
+// to exist.
+func (r *AppReconciler) Render(ctx context.Context, app *shipcapsv1beta1.App) (*AppRender, error) {
+	cap, err := r.getCap(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	if err := cap.CheckConsumer(ctx, r.Client, app); err != nil {
+		return nil, err
+	}
+	if err := cap.CheckAppLimit(ctx, r.Client, app); err != nil {
+		return nil, err
+	}
+	capRev, err := r.useCapRevision(ctx, app, &cap)
+	if err != nil {
+		return nil, err
+	}
+	render, err := r.renderApp(ctx, app, &cap)
+	if err != nil {
+		return nil, err
+	}
+	if capRev != nil {
+		render.CapRevision = capRev.Revision
+	}
+	return render, nil
+}
+
+// useCapRevision replaces the spec of the given Cap with the revision the App is pinned to, or the rollout allows.
+// Returns nil if the Cap has no revisions recorded yet, in which case its current spec is used.
+func (r *AppReconciler) useCapRevision(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) (*shipcapsv1beta1.CapRevision, error) {
+	capRev, err := cap.SelectRevision(app)
+	if err != nil || capRev == nil {
+		return nil, err
+	}
+	if hash, err := cap.Spec.RevisionHash(); err != nil || hash != capRev.Hash {
+		spec, err := loadCapRevision(ctx, r.Client, cap, capRev.Revision, r.ClusterCapAuthNamespace)
 		if err != nil {
-			return ctrl.Result{}, err
+			return nil, err
 		}
+		cap.UseRevisionSpec(*spec)
+	}
+	return capRev, nil
+}
 
-		switch dep.Spec.Source.Type {
-		case shipcapsv1beta1.SimpleCapSourceType:
-			if err := r.ReconcileSimpleCapTypeApp(dep.Spec.Source, &app, depValues, ctx, log); err != nil {
-				return ctrl.Result{}, err
-			}
-		case shipcapsv1beta1.HelmChartCapSourceType:
-			if err := r.ReconcileHelmChartCapTypeApp(dep.Spec.Source, app, depValues, ctx, log); err != nil {
-				return ctrl.Result{}, err
+// renderApp renders the dependencies and the Cap of the given App
+func (r *AppReconciler) renderApp(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) (*AppRender, error) {
+	render := AppRender{
+		CapName:       cap.Name,
+		CapGeneration: cap.Generation,
+		CapVersion:    cap.Spec.Version,
+	}
+
+	// Render the Dependencies for this App
+	for _, dep := range cap.Spec.Dependencies {
+		capdep := shipcapsv1beta1.CapDep{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: dep.Name, Namespace: dep.Namespace}, &capdep); err != nil {
+			depCtx := errors.Context{Cap: cap.CapKey(), Object: fmt.Sprintf("CapDep %s/%s", dep.Namespace, dep.Name)}
+			if apierrors.IsNotFound(err) {
+				return nil, errors.Wrap(errors.DependencyNotReadyCode, err, "").With(depCtx)
 			}
+			return nil, err
+		}
+		depCtx := errors.Context{Cap: cap.CapKey(), Object: fmt.Sprintf("CapDep %s/%s", capdep.Namespace, capdep.Name)}
+		depValues, err := capdep.RenderValues()
+		if err != nil {
+			return nil, errors.Wrap(errors.InvalidValuesCode, err, "").With(depCtx)
+		}
+		objs, err := r.renderSource(ctx, capdep.Spec.Source, capdep.Namespace, app, depValues)
+		if err != nil {
+			return nil, errors.Wrap(errors.RenderFailedCode, err, "").With(depCtx)
 		}
+		render.Dependencies = append(render.Dependencies, objs...)
 	}
 
-	// Reconcile the App itself
-	capValues, err := cap.RenderValues(&app)
+	// Render the App itself
+	resolver := parsing.NewClientValueFromResolver(ctx, r.Client, app.Namespace)
+	capValues, err := cap.RenderValues(app, resolver)
 	if err != nil {
-		return ctrl.Result{}, err
+		return nil, err
 	}
+	render.Values = capValues
+	if render.SecretTargets, err = r.secretTargets(ctx, app, cap); err != nil {
+		return nil, err
+	}
+	render.Objects, err = r.renderSource(ctx, cap.Spec.Source, cap.Namespace, app, capValues)
+	if err != nil {
+		return nil, errors.Wrap(errors.RenderFailedCode, err, "").With(errors.Context{App: app.AppKey(), Cap: cap.CapKey()})
+	}
+	if err := r.checkRender(ctx, app, cap, &render); err != nil {
+		return nil, err
+	}
+
+	return &render, nil
+}
+
+// checkRender renders the objects and dependencies of the render into the App's target namespace, and checks them
+// against the allowed namespaces and the CapPolicies that apply to the Cap
+func (r *AppReconciler) checkRender(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap, render *AppRender) error {
+	objs := append(append([]map[string]interface{}{}, render.Dependencies...), render.Objects...)
+	if err := r.targetNamespaces(app, cap, objs); err != nil {
+		return err
+	}
+	return r.enforcePolicies(ctx, app, cap, objs)
+}
 
-	switch cap.Spec.Source.Type {
+// renderSource renders the given source for the App, according to its type
+func (r *AppReconciler) renderSource(ctx context.Context, src shipcapsv1beta1.CapSource, authNamespace string, app *shipcapsv1beta1.App, capValues parsing.CapValues) ([]map[string]interface{}, error) {
+	switch src.Type {
 	case shipcapsv1beta1.SimpleCapSourceType:
-		if err := r.ReconcileSimpleCapTypeApp(cap.Spec.Source, &app, capValues, ctx, log); err != nil {
-			return ctrl.Result{}, err
+		list, err := r.RenderSimpleCapTypeApp(src, authNamespace, capValues, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var objs []map[string]interface{}
+		for _, item := range list.Items {
+			objs = append(objs, item.Object)
 		}
+		return objs, nil
 	case shipcapsv1beta1.HelmChartCapSourceType:
-		if err := r.ReconcileHelmChartCapTypeApp(cap.Spec.Source, app, capValues, ctx, log); err != nil {
-			return ctrl.Result{}, err
+		obj, err := r.RenderHelmChartCapTypeApp(src, *app, capValues, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{obj.Object}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// applyRenderedObject applies a single rendered object for the given App. Objects in the App's namespace are owned by
+// the App, as owner references can't cross namespaces. The object is applied with the given client.
+func (r *AppReconciler) applyRenderedObject(ctx context.Context, c client.Client, app *shipcapsv1beta1.App, content map[string]interface{}, policy ApplyPolicy, log logr.Logger) error {
+	entry := unstructured.Unstructured{Object: runtime.DeepCopyJSON(content)}
+	if entry.GetNamespace() == app.Namespace {
+		if err := controllerutil.SetControllerReference(app, &entry, r.Scheme); err != nil {
+			return err
+		}
+	}
+	if err := r.applyRendered(ctx, c, app, &entry, policy); err != nil {
+		code := errors.ApplyFailedCode
+		switch {
+		case apierrors.IsConflict(err):
+			code = errors.ApplyConflictCode
+		case apierrors.IsForbidden(err):
+			code = errors.ApplyForbiddenCode
+		}
+		return errors.Wrap(code, err, "").With(errors.Context{
+			App:    app.AppKey(),
+			Object: fmt.Sprintf("%s %s", entry.GetKind(), strings.TrimPrefix(entry.GetNamespace()+"/"+entry.GetName(), "/")),
+		})
+	}
+	log.V(1).Info(fmt.Sprintf("resource [kind: %s, name: %s, namespace: %s] reconciled", entry.GetKind(), entry.GetName(), entry.GetNamespace()))
+	return nil
+}
+
+// applyPolicy returns the policy to apply the Cap's rendered objects for the given App with
+func applyPolicy(app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) ApplyPolicy {
+	policy := ApplyPolicy{ForceOwnership: cap.Spec.ForceOwnership}
+	if cap.Spec.DriftPolicy != nil {
+		policy.Drift = *cap.Spec.DriftPolicy
+	}
+	if app.Spec.DriftPolicy != nil {
+		policy.Drift = *app.Spec.DriftPolicy
+	}
+	return policy
+}
+
+// event records an event for the given App, if a recorder is configured
+func (r *AppReconciler) event(app *shipcapsv1beta1.App, eventtype, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(app, eventtype, reason, message)
+	}
+}
+
+// getCap fetches the Cap or ClusterCap referenced by the given App
+func (r *AppReconciler) getCap(ctx context.Context, app *shipcapsv1beta1.App) (shipcapsv1beta1.Cap, error) {
+	return app.GetCap(ctx, r.Client)
+}
+
+// appsForCap maps a Cap or ClusterCap to all Apps referencing it
+func (r *AppReconciler) appsForCap() handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		var apps shipcapsv1beta1.AppList
+		if err := r.List(context.Background(), &apps); err != nil {
+			r.Log.Error(err, "unable to list Apps for cap", "cap", obj.Meta.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, app := range apps.Items {
+			if !app.ReferencesCap(obj.Meta.GetName(), obj.Meta.GetNamespace()) {
+				continue
+			}
+			reqs = append(reqs, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+			})
+		}
+		return reqs
+	}
+}
+
+// appsInNamespace maps a Namespace to all Apps in it, as its labels decide which Caps they may use
+func (r *AppReconciler) appsInNamespace() handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		var apps shipcapsv1beta1.AppList
+		if err := r.List(context.Background(), &apps, client.InNamespace(obj.Meta.GetName())); err != nil {
+			r.Log.Error(err, "unable to list Apps for namespace", "namespace", obj.Meta.GetName())
+			return nil
+		}
+		reqs := make([]reconcile.Request, 0, len(apps.Items))
+		for _, app := range apps.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name}})
 		}
+		return reqs
 	}
+}
+
+// appsForValueSource maps a Secret or ConfigMap to all Apps in its namespace, whose values (or whose Cap's values)
+// read from it.
+func (r *AppReconciler) appsForValueSource(secret bool) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		ctx := context.Background()
+		name := obj.Meta.GetName()
+
+		var apps shipcapsv1beta1.AppList
+		if err := r.List(ctx, &apps, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+			r.Log.Error(err, "unable to list Apps for value source", "namespace", obj.Meta.GetNamespace())
+			return nil
+		}
 
-	log.V(1).Info("Successfully Reconciled")
-	return ctrl.Result{
-		RequeueAfter: r.RequeueDuration,
-	}, nil
+		var reqs []reconcile.Request
+		for _, app := range apps.Items {
+			referenced := app.ReferencesValueSource(name, secret)
+			if !referenced {
+				cap, err := r.getCap(ctx, &app)
+				if err != nil {
+					continue
+				}
+				referenced = cap.ReferencesValueSource(name, secret)
+			}
+			if referenced {
+				reqs = append(reqs, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+				})
+			}
+		}
+		return reqs
+	}
 }
 
 func makeHelmValues(in map[string]interface{}) map[string]interface{} {
@@ -184,68 +588,142 @@ func makeHelmValues(in map[string]interface{}) map[string]interface{} {
 
 }
 
-func (r *AppReconciler) ReconcileHelmChartCapTypeApp(src shipcapsv1beta1.CapSource, app shipcapsv1beta1.App, capValues parsing.CapValues, ctx context.Context, log logr.Logger) error {
+// repoCredentials resolves the credentials of the source's repo. The referenced Secrets and ConfigMaps are read from
+// the given namespace, or the ClusterCapAuthNamespace for cluster-scoped sources.
+func (r *AppReconciler) repoCredentials(ctx context.Context, src shipcapsv1beta1.CapSource, namespace string) (*gitrepo.Credentials, error) {
+	if namespace == "" {
+		namespace = r.ClusterCapAuthNamespace
+	}
+	resolver := parsing.NewClientValueFromResolver(ctx, r.Client, namespace)
+	return gitrepo.ResolveCredentials(src.Repo.Auth, resolver)
+}
+
+// RenderHelmChartCapTypeApp renders a HelmRelease for the given App, that installs the chart of the source with
+// the given values.
+func (r *AppReconciler) RenderHelmChartCapTypeApp(src shipcapsv1beta1.CapSource, app shipcapsv1beta1.App, capValues parsing.CapValues, ctx context.Context) (*unstructured.Unstructured, error) {
+	if err := src.Check(); err != nil {
+		return nil, err
+	}
+
 	helmValueMap := makeHelmValues(capValues.Map())
 
 	helmRel := helmv1.HelmRelease{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: helmv1.SchemeGroupVersion.String(),
+			Kind:       "HelmRelease",
+		},
 		ObjectMeta: v1.ObjectMeta{
 			Name:      app.Name,
 			Namespace: app.Namespace,
 		},
 	}
-	couFunc := func() error {
-		helmRel.Spec.Values = helmValueMap
-		cs := helmv1.GitChartSource{
-			GitURL: src.Repo.URI,
-			Ref:    src.Repo.Ref,
-			Path:   src.Repo.Path,
-		}
-		helmRel.Spec.GitChartSource = &cs
-		return nil
+	if app.Spec.TargetNamespace != "" {
+		helmRel.Spec.TargetNamespace = app.Spec.TargetNamespace
+	}
+	helmRel.Spec.Values = helmValueMap
+	helmRel.Spec.GitChartSource = &helmv1.GitChartSource{
+		GitURL: src.Repo.URI,
+		Ref:    src.Repo.Ref,
+		Path:   src.Repo.Path,
 	}
-	_, err := ctrl.CreateOrUpdate(ctx, r.Client, &helmRel, couFunc)
+
+	// The chart source embeds its variants, which only JSON encoding inlines as the CRD expects.
+	data, err := json.Marshal(&helmRel)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	obj := unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	// Only apply what we actually set. The typed struct adds nulls and empty structs for everything else, which server
+	// side apply would take ownership of. The values are kept as they are, as nulls are meaningful to helm.
+	unstructured.RemoveNestedField(obj.Object, "status")
+	values, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "values")
+	unstructured.RemoveNestedField(obj.Object, "spec", "values")
+	removeEmptyFields(obj.Object)
+	if values, ok := values.(map[string]interface{}); ok && len(values) > 0 {
+		if err := unstructured.SetNestedMap(obj.Object, values, "spec", "values"); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return &obj, nil
 }
 
-func (r *AppReconciler) ReconcileSimpleCapTypeApp(src shipcapsv1beta1.CapSource, app *shipcapsv1beta1.App, capValues parsing.CapValues, ctx context.Context, log logr.Logger) error {
+// removeEmptyFields recursively removes null fields, and maps and lists that are empty or end up empty, from the
+// given object
+func removeEmptyFields(obj map[string]interface{}) {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case nil:
+			delete(obj, key)
+		case map[string]interface{}:
+			removeEmptyFields(v)
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		}
+	}
+}
 
-	var err error
-	if err = src.Check(); err != nil {
-		return err
+// RenderSimpleCapTypeApp renders the manifests of the source with the given values
+func (r *AppReconciler) RenderSimpleCapTypeApp(src shipcapsv1beta1.CapSource, authNamespace string, capValues parsing.CapValues, ctx context.Context) (unstructured.UnstructuredList, error) {
+	if err := src.Check(); err != nil {
+		return unstructured.UnstructuredList{}, err
 	}
 
-	var processedOut unstructured.UnstructuredList
-	if src.IsInLine() {
-		processedOut, err = src.GetUnstructuredObjects(capValues)
+	if src.IsRepo() {
+		creds, err := r.repoCredentials(ctx, src, authNamespace)
 		if err != nil {
-			return err
+			return unstructured.UnstructuredList{}, err
 		}
-	}
-
-	for _, entry := range processedOut.Items {
-		couFunc := func() error { return nil }
-		if entry.GetNamespace() != "" {
-			if err := controllerutil.SetControllerReference(app, &entry, r.Scheme); err != nil {
-				return err
-			}
+		fs, err := r.checkouts.Checkout(ctx, src.Repo, creds)
+		if err != nil {
+			return unstructured.UnstructuredList{}, errors.Wrap(errors.SourceFetchFailedCode, err, fmt.Sprintf("unable to checkout repo '%s'", src.Repo.URI))
 		}
-		res, err := ctrl.CreateOrUpdate(ctx, r.Client, &entry, couFunc)
-		log.V(1).Info(fmt.Sprintf("resource [kind: %s, name: %s, namespace: %s] %s", entry.GetKind(), entry.GetName(), entry.GetNamespace(), res))
+		manifests, err := gitrepo.ReadManifests(fs, src.Repo.Path)
 		if err != nil {
-			return err
+			return unstructured.UnstructuredList{}, errors.Wrap(errors.SourceFetchFailedCode, err, "")
 		}
+		return shipcapsv1beta1.RenderManifests(manifests, capValues)
 	}
 
-	return nil
+	return src.GetUnstructuredObjects(capValues)
 }
 
 func (r *AppReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := metrics.Registry.Register(&stateCollector{reader: mgr.GetClient()}); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&shipcapsv1beta1.App{}).
 		Owns(&helmv1.HelmRelease{}).
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.App{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.appsConsumingOutputs),
+		}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.Cap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsForCap(),
+		}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.ClusterCap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsForCap(),
+		}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsForValueSource(true),
+		}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsForValueSource(false),
+		}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsInNamespace(),
+		}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.CapPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.appsForPolicy(),
+		}).
 		Complete(r)
 }
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// reconcileOutputs reads all outputs the Cap declares, and publishes them into the App status and, if required, the
+// outputs Secret of the App. Rendered outputs are read from the given render.
+func (r *AppReconciler) reconcileOutputs(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap, render *AppRender) error {
+	if len(cap.Spec.Outputs) == 0 {
+		app.Status.Outputs = nil
+		app.Status.OutputsSecretName = ""
+		return nil
+	}
+
+	outputs := make(map[string]string)
+	secretData := make(map[string][]byte)
+	publishSecret := app.Spec.PublishOutputsSecret
+	for _, out := range cap.Spec.Outputs {
+		ref, err := out.RenderObjectRef(app, render.Values)
+		if err != nil {
+			return err
+		}
+
+		var obj unstructured.Unstructured
+		switch out.From {
+		case shipcapsv1beta1.RenderedOutputSourceType:
+			found := false
+			for _, item := range render.Objects {
+				if ref.Matches(unstructured.Unstructured{Object: item}) {
+					obj, found = unstructured.Unstructured{Object: item}, true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("output '%s' references %s '%s', which is not rendered by the Cap", out.Name, ref.Kind, ref.Name)
+			}
+		default:
+			obj.SetAPIVersion(ref.APIVersion)
+			obj.SetKind(ref.Kind)
+			if err := r.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, &obj); err != nil {
+				if apierrors.IsNotFound(err) {
+					return errors.NewShipCapsError(shipcapsv1beta1.OutputNotAvailableCode, fmt.Sprintf("%s '%s/%s' for output '%s' does not exist yet", ref.Kind, ref.Namespace, ref.Name, out.Name))
+				}
+				return err
+			}
+		}
+
+		val, err := out.Extract(obj)
+		if err != nil {
+			return err
+		}
+		if out.Sensitive {
+			publishSecret = true
+		} else {
+			outputs[out.Name] = val
+		}
+		secretData[out.Name] = []byte(val)
+	}
+
+	app.Status.Outputs = outputs
+	app.Status.OutputsSecretName = ""
+	if !publishSecret {
+		return nil
+	}
+
+	secret := corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      app.OutputsSecretName(),
+			Namespace: app.Namespace,
+		},
+	}
+	_, err := ctrl.CreateOrUpdate(ctx, r.Client, &secret, func() error {
+		secret.Data = secretData
+		return controllerutil.SetControllerReference(app, &secret, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	app.Status.OutputsSecretName = secret.Name
+
+	return nil
+}
+
+// appsConsumingOutputs maps an App to all Apps in its namespace that consume one of its outputs
+func (r *AppReconciler) appsConsumingOutputs(obj handler.MapObject) []reconcile.Request {
+	var apps shipcapsv1beta1.AppList
+	if err := r.List(context.Background(), &apps, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list Apps for outputs", "namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, app := range apps.Items {
+		if app.ReferencesAppOutput(obj.Meta.GetName()) {
+			reqs = append(reqs, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+			})
+		}
+	}
+	return reqs
+}
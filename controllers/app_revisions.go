@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+const (
+	// RevisionSecretType is the type of the Secrets holding App revisions
+	RevisionSecretType corev1.SecretType = "shipcaps.redradrat.xyz/revision"
+
+	// RevisionAppLabel holds the name of the App a revision Secret belongs to
+	RevisionAppLabel = "shipcaps.redradrat.xyz/app"
+	// RevisionLabel holds the number of the revision a revision Secret holds
+	RevisionLabel = "shipcaps.redradrat.xyz/revision"
+	// RevisionHashAnnotation holds the hash of the render a revision Secret holds
+	RevisionHashAnnotation = "shipcaps.redradrat.xyz/revision-hash"
+	// RevisionCapGenerationAnnotation holds the generation of the Cap a revision was rendered from
+	RevisionCapGenerationAnnotation = "shipcaps.redradrat.xyz/cap-generation"
+
+	revisionDataKey = "render"
+)
+
+// AppRender holds everything rendered for an App, which is exactly what is applied
+type AppRender struct {
+	// CapName is the name of the Cap the App was rendered from
+	CapName string `json:"capName"`
+
+	// CapGeneration is the generation of the Cap the App was rendered from
+	CapGeneration int64 `json:"capGeneration"`
+
+	// CapRevision is the revision of the Cap the App was rendered from
+	CapRevision int64 `json:"capRevision,omitempty"`
+
+	// CapVersion is the version of the Cap the App was rendered from
+	CapVersion string `json:"capVersion,omitempty"`
+
+	// Values are the resolved values the Cap was rendered with
+	Values parsing.CapValues `json:"values,omitempty"`
+
+	// SecretTargets are the targetIds of the values that were read from Secrets. It is nil in revisions recorded
+	// before secret values were tracked.
+	SecretTargets []parsing.TargetIdentifier `json:"secretTargets"`
+
+	// Dependencies are the objects rendered from the Cap's dependencies, which are applied first
+	Dependencies []map[string]interface{} `json:"dependencies,omitempty"`
+
+	// Objects are the objects rendered from the Cap itself
+	Objects []map[string]interface{} `json:"objects,omitempty"`
+}
+
+// Hash returns a hash of the render, to tell whether anything changed
+func (render *AppRender) Hash() (string, error) {
+	data, err := json.Marshal(render)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// reconcileRevisions records the given render as new revision, if it differs from the latest one, prunes revisions
+// beyond the App's history limit and updates the App status. Nothing is recorded for Apps pinned to a revision.
+func (r *AppReconciler) reconcileRevisions(ctx context.Context, app *shipcapsv1beta1.App, render *AppRender) error {
+	revisions, err := r.listRevisions(ctx, app)
+	if err != nil {
+		return err
+	}
+
+	if app.Spec.Revision != nil {
+		app.Status.Revision = *app.Spec.Revision
+		app.Status.History = revisions
+		return nil
+	}
+
+	hash, err := render.Hash()
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 || revisions[len(revisions)-1].Hash != hash {
+		next := int64(1)
+		if len(revisions) > 0 {
+			next = revisions[len(revisions)-1].Revision + 1
+		}
+		rev, err := r.storeRevision(ctx, app, render, next, hash)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, rev)
+		r.event(app, corev1.EventTypeNormal, RevisionCreatedEventReason, fmt.Sprintf("Recorded revision %d", next))
+	}
+	app.Status.Revision = revisions[len(revisions)-1].Revision
+
+	for len(revisions) > app.GetRevisionHistoryLimit() {
+		secret := corev1.Secret{ObjectMeta: v1.ObjectMeta{Namespace: app.Namespace, Name: revisions[0].SecretName}}
+		if err := r.Delete(ctx, &secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.event(app, corev1.EventTypeNormal, RevisionPrunedEventReason, fmt.Sprintf("Pruned revision %d", revisions[0].Revision))
+		revisions = revisions[1:]
+	}
+	app.Status.History = revisions
+
+	return nil
+}
+
+// listRevisions returns all stored revisions of the given App, oldest first
+func (r *AppReconciler) listRevisions(ctx context.Context, app *shipcapsv1beta1.App) ([]shipcapsv1beta1.AppRevision, error) {
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets, client.InNamespace(app.Namespace), client.MatchingLabels{RevisionAppLabel: app.Name}); err != nil {
+		return nil, err
+	}
+
+	var revisions []shipcapsv1beta1.AppRevision
+	for _, secret := range secrets.Items {
+		if secret.Type != RevisionSecretType {
+			continue
+		}
+		rev, err := strconv.ParseInt(secret.Labels[RevisionLabel], 10, 64)
+		if err != nil {
+			continue
+		}
+		capGeneration, _ := strconv.ParseInt(secret.Annotations[RevisionCapGenerationAnnotation], 10, 64)
+		revisions = append(revisions, shipcapsv1beta1.AppRevision{
+			Revision:      rev,
+			CapGeneration: capGeneration,
+			Hash:          secret.Annotations[RevisionHashAnnotation],
+			SecretName:    secret.Name,
+			Created:       secret.CreationTimestamp,
+		})
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// storeRevision writes the given render as compressed revision Secret owned by the App
+func (r *AppReconciler) storeRevision(ctx context.Context, app *shipcapsv1beta1.App, render *AppRender, revision int64, hash string) (shipcapsv1beta1.AppRevision, error) {
+	data, err := json.Marshal(render)
+	if err != nil {
+		return shipcapsv1beta1.AppRevision{}, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return shipcapsv1beta1.AppRevision{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return shipcapsv1beta1.AppRevision{}, err
+	}
+
+	secret := corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      app.RevisionSecretName(revision),
+			Namespace: app.Namespace,
+			Labels: map[string]string{
+				RevisionAppLabel: app.Name,
+				RevisionLabel:    strconv.FormatInt(revision, 10),
+			},
+			Annotations: map[string]string{
+				RevisionHashAnnotation:          hash,
+				RevisionCapGenerationAnnotation: strconv.FormatInt(render.CapGeneration, 10),
+			},
+		},
+		Type: RevisionSecretType,
+		Data: map[string][]byte{
+			revisionDataKey: buf.Bytes(),
+		},
+	}
+	if err := controllerutil.SetControllerReference(app, &secret, r.Scheme); err != nil {
+		return shipcapsv1beta1.AppRevision{}, err
+	}
+	// The cache might not have caught up with a revision we just created, in which case it already holds this render.
+	if err := r.Create(ctx, &secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return shipcapsv1beta1.AppRevision{}, err
+	}
+
+	return shipcapsv1beta1.AppRevision{
+		Revision:      revision,
+		CapGeneration: render.CapGeneration,
+		Hash:          hash,
+		SecretName:    secret.Name,
+		Created:       v1.Now(),
+	}, nil
+}
+
+// loadRevision reads the render of the given revision of the App
+func (r *AppReconciler) loadRevision(ctx context.Context, app *shipcapsv1beta1.App, revision int64) (*AppRender, error) {
+	secret := corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: app.RevisionSecretName(revision)}, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("revision %d of app '%s' does not exist", revision, app.Name)
+		}
+		return nil, err
+	}
+	if secret.Type != RevisionSecretType || secret.Labels[RevisionAppLabel] != app.Name {
+		return nil, fmt.Errorf("secret '%s' is not a revision of app '%s'", secret.Name, app.Name)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(secret.Data[revisionDataKey]))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read revision %d of app '%s': %w", revision, app.Name, err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read revision %d of app '%s': %w", revision, app.Name, err)
+	}
+	var render AppRender
+	if err := json.Unmarshal(data, &render); err != nil {
+		return nil, fmt.Errorf("unable to decode revision %d of app '%s': %w", revision, app.Name, err)
+	}
+	return &render, nil
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// FieldManager is the field manager shipcaps applies rendered objects with
+const FieldManager = "shipcaps"
+
+// ApplyPolicy controls how rendered objects are applied
+type ApplyPolicy struct {
+	// ForceOwnership selects fields that are applied, even if they are managed by another field manager
+	ForceOwnership []shipcapsv1beta1.FieldSelector
+
+	// Drift specifies how out-of-band changes to the applied objects are handled
+	Drift shipcapsv1beta1.DriftPolicy
+
+	// Conflicts are the conflicts recorded by the previous apply. Their fields are left to the other field managers.
+	Conflicts []shipcapsv1beta1.AppObjectConflict
+}
+
+// applyRendered applies a rendered object for the given App with the given client, according to the given policy.
+// Drift and conflicts are recorded in the App status.
+func (r *AppReconciler) applyRendered(ctx context.Context, c client.Client, app *shipcapsv1beta1.App, obj *unstructured.Unstructured, policy ApplyPolicy) error {
+	hash, err := renderHash(obj.Object)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RenderHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+
+	force := policy.ForceOwnership
+	live := unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	err = c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}, &live)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if err == nil && live.GetAnnotations()[RenderHashAnnotation] == hash {
+		// The rendered object did not change since we last applied it, so any difference is drift. The live object is
+		// compared with the result of a dry-run apply rather than the rendered object, so defaults and canonical forms
+		// set by the apiserver don't show up as drift.
+		applied := obj.DeepCopy()
+		if err := c.Patch(ctx, applied, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership, client.DryRunAll); err != nil {
+			return err
+		}
+		// Fields another field manager took over are theirs, like the fields of conflicts, unless we force them.
+		others := append(managedByOthers(&live), conflictFields(policy.Conflicts, obj)...)
+		var drifted, ignored []string
+		for _, field := range driftedFields(applied.Object, live.Object) {
+			if coversField(others, field) && !shipcapsv1beta1.SelectsField(policy.ForceOwnership, *obj, field) {
+				continue
+			}
+			if shipcapsv1beta1.SelectsField(policy.Drift.Ignore, *obj, field) {
+				ignored = append(ignored, field)
+			} else {
+				drifted = append(drifted, field)
+			}
+		}
+		if len(drifted) == 0 {
+			// Nothing to correct, so there is no need to apply at all.
+			return nil
+		}
+
+		drift := shipcapsv1beta1.AppObjectDrift{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Fields:     drifted,
+		}
+		if policy.Drift.Mode == shipcapsv1beta1.ReportDriftMode {
+			app.Status.Drift = append(app.Status.Drift, drift)
+			r.event(app, corev1.EventTypeWarning, DriftDetectedEventReason, fmt.Sprintf("%s '%s' drifted: %s", obj.GetKind(), obj.GetName(), strings.Join(drifted, ", ")))
+			return nil
+		}
+
+		// Leave out the ignored fields, so we don't revert them.
+		for _, field := range ignored {
+			path, ok := fieldPath(field)
+			if !ok {
+				app.Status.Drift = append(app.Status.Drift, drift)
+				r.event(app, corev1.EventTypeWarning, DriftDetectedEventReason, fmt.Sprintf("%s '%s' drifted, but can't be corrected without reverting ignored field '%s': %s", obj.GetKind(), obj.GetName(), field, strings.Join(drifted, ", ")))
+				return nil
+			}
+			unstructured.RemoveNestedField(obj.Object, path...)
+		}
+
+		// Take over the drifted fields, as they are most likely managed by whoever changed them.
+		paths := make([]string, 0, len(drifted))
+		for _, field := range drifted {
+			paths = append(paths, ownershipPath(field))
+		}
+		force = append(force[:len(force):len(force)], shipcapsv1beta1.FieldSelector{
+			Kind:  obj.GetKind(),
+			Name:  obj.GetName(),
+			Paths: paths,
+		})
+		drift.Corrected = true
+		app.Status.Drift = append(app.Status.Drift, drift)
+		objectsApplied.WithLabelValues(app.Namespace, app.Name).Inc()
+		r.event(app, corev1.EventTypeNormal, DriftCorrectedEventReason, fmt.Sprintf("%s '%s' drifted and was corrected: %s", obj.GetKind(), obj.GetName(), strings.Join(drifted, ", ")))
+	}
+
+	conflict, applied, err := r.applyObject(ctx, c, obj, force)
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		app.Status.Conflicts = append(app.Status.Conflicts, *conflict)
+		r.event(app, corev1.EventTypeWarning, ConflictEventReason, fmt.Sprintf("%s '%s': %s: %s", obj.GetKind(), obj.GetName(), conflict.Message, strings.Join(conflict.Fields, ", ")))
+	}
+	switch {
+	case !applied:
+		// The object was left as is, which the conflict event above reports.
+	case live.GetUID() == "" && obj.GetKind() == "HelmRelease":
+		objectsApplied.WithLabelValues(app.Namespace, app.Name).Inc()
+		r.event(app, corev1.EventTypeNormal, HelmReleaseCreatedEventReason, fmt.Sprintf("Created HelmRelease '%s'", obj.GetName()))
+	case live.GetUID() == "":
+		objectsApplied.WithLabelValues(app.Namespace, app.Name).Inc()
+		r.event(app, corev1.EventTypeNormal, CreatedEventReason, fmt.Sprintf("Created %s '%s'", obj.GetKind(), obj.GetName()))
+	case live.GetAnnotations()[RenderHashAnnotation] != hash:
+		objectsApplied.WithLabelValues(app.Namespace, app.Name).Inc()
+		r.event(app, corev1.EventTypeNormal, UpdatedEventReason, fmt.Sprintf("Updated %s '%s'", obj.GetKind(), obj.GetName()))
+	}
+	return nil
+}
+
+// applyObject applies the given object with server-side apply. If fields of the object are managed by another field
+// manager, only those selected by the force rules are taken over; all others are left out of the applied object and
+// reported in the returned conflict. Returns false if the object could not be applied at all.
+func (r *AppReconciler) applyObject(ctx context.Context, c client.Client, obj *unstructured.Unstructured, force []shipcapsv1beta1.FieldSelector) (*shipcapsv1beta1.AppObjectConflict, bool, error) {
+	err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager))
+	if err == nil || !apierrors.IsConflict(err) {
+		return nil, err == nil, err
+	}
+
+	// Sort the conflicting fields into those we want to force, and those we leave to the other manager.
+	var unforced []string
+	for _, field := range conflictingFields(err) {
+		if !shipcapsv1beta1.SelectsField(force, *obj, field) {
+			unforced = append(unforced, field)
+		}
+	}
+
+	conflict := &shipcapsv1beta1.AppObjectConflict{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Fields:     unforced,
+	}
+	for _, field := range unforced {
+		path, ok := fieldPath(field)
+		if !ok {
+			// We can't leave out single list entries, so we rather don't apply this object at all.
+			conflict.Message = fmt.Sprintf("object not applied, as field '%s' is managed by another field manager", field)
+			return conflict, false, nil
+		}
+		unstructured.RemoveNestedField(obj.Object, path...)
+	}
+
+	if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return nil, false, err
+	}
+	if len(unforced) == 0 {
+		return nil, true, nil
+	}
+	conflict.Message = "fields managed by another field manager were not applied"
+	return conflict, true, nil
+}
+
+// conflictingFields extracts the conflicting field paths from a server-side apply conflict error
+func conflictingFields(err error) []string {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == v1.CauseTypeFieldManagerConflict {
+			fields = append(fields, cause.Field)
+		}
+	}
+	return fields
+}
+
+// fieldPath converts a field path like ".spec.replicas" into its segments. Paths selecting list entries can't be
+// converted.
+func fieldPath(field string) ([]string, bool) {
+	if strings.ContainsAny(field, "[]") {
+		return nil, false
+	}
+	return strings.Split(strings.TrimPrefix(field, "."), "."), true
+}
@@ -18,14 +18,17 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"reflect"
 
 	"github.com/go-logr/logr"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
 )
@@ -35,12 +38,18 @@ type CapReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// Recorder records events for Caps
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=caps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=caps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capdeps,verbs=get;list;watch
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capsdeps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=apps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *CapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -51,36 +60,43 @@ func (r *CapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.V(1).Info("unable to fetch Cap")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	status := cap.Status.DeepCopy()
 
-	// return if only status/metadata updated
-	if cap.Status.ObservedGeneration == cap.ObjectMeta.Generation {
-		return ctrl.Result{}, nil
-	} else {
-		cap.Status.ObservedGeneration = cap.ObjectMeta.Generation
-		r.Status().Update(ctx, &cap)
+	cap.Status.ObservedGeneration = cap.ObjectMeta.Generation
+	if err := reconcilePolicies(ctx, r.Client, &cap); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := reconcileUsage(ctx, r.Client, &cap); err != nil {
+		return ctrl.Result{}, err
+	}
+	releaser := capReleaser{Client: r.Client, Scheme: r.Scheme}
+	requeue, err := releaser.reconcile(ctx, &cap, &cap, cap.Namespace)
+	if err != nil {
+		if r.Recorder != nil {
+			r.Recorder.Event(&cap, corev1.EventTypeWarning, ReconcileFailedEventReason, err.Error())
+		}
+		return ctrl.Result{}, err
 	}
 
-	src := cap.Spec.Source
-
-	if src.IsInLine() {
-		mans := src.InLine
-		unstruct := []unstructured.Unstructured{}
-		if err := json.Unmarshal(mans, &unstruct); err != nil {
+	if !reflect.DeepEqual(status, &cap.Status) {
+		recordCapEvents(r.Recorder, &cap, status, &cap.Status)
+		if err := r.Status().Update(ctx, &cap); err != nil {
 			return ctrl.Result{}, err
 		}
-		for _, man := range unstruct {
-			fmt.Println(fmt.Sprintf("Resource: %s | Name: %s", man.GroupVersionKind().String(), man.GetName()))
-			//if err := r.Client.Create(ctx, &man, client.DryRunAll); err != nil {
-			//	return ctrl.Result{}, err
-			//}
-		}
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeue}, nil
 }
 
 func (r *CapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&shipcapsv1beta1.Cap{}).
+		Owns(&appsv1.ControllerRevision{}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.App{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: capForApp(false),
+		}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.CapPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: capsForPolicy(mgr.GetClient(), r.Log, false),
+		}).
 		Complete(r)
 }
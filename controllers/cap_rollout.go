@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+const (
+	// CapRevisionLabel holds the name of the Cap or ClusterCap a ControllerRevision belongs to
+	CapRevisionLabel = "shipcaps.redradrat.xyz/cap"
+	// CapRevisionKindLabel holds the kind (Cap or ClusterCap) a ControllerRevision belongs to
+	CapRevisionKindLabel = "shipcaps.redradrat.xyz/cap-kind"
+
+	// capRevisionHistoryLimit is the number of Cap revisions kept, in addition to those still used by Apps
+	capRevisionHistoryLimit = 10
+)
+
+// capReleaser records immutable revisions of Caps and ClusterCaps, and rolls them out to their Apps. ClusterCaps are
+// handled as Caps without a namespace.
+type capReleaser struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// capRevisionName returns the name of the ControllerRevision holding the given revision of the Cap. ClusterCap
+// revisions share the namespace with Caps, so their names end in ".clustercap" rather than the revision number, which
+// the names of Cap revisions always end in.
+func capRevisionName(cap *shipcapsv1beta1.Cap, revision int64) string {
+	if cap.Namespace == "" {
+		return fmt.Sprintf("%s-%d.clustercap", cap.Name, revision)
+	}
+	return fmt.Sprintf("%s-%d", cap.Name, revision)
+}
+
+// reconcile records a new revision if the Cap's spec changed, and advances its rollout. The owner is the actual Cap
+// or ClusterCap object, and namespace the one the revisions are stored in. The returned duration is the time after
+// which the rollout should be checked again, if it is paused.
+func (c *capReleaser) reconcile(ctx context.Context, owner v1.Object, cap *shipcapsv1beta1.Cap, namespace string) (time.Duration, error) {
+	var list shipcapsv1beta1.AppList
+	if err := c.List(ctx, &list); err != nil {
+		return 0, err
+	}
+	var apps []shipcapsv1beta1.App
+	for _, app := range list.Items {
+		if app.ReferencesCap(cap.Name, cap.Namespace) {
+			apps = append(apps, app)
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].AppKey() < apps[j].AppKey()
+	})
+
+	if err := c.recordRevision(ctx, owner, cap, namespace, apps); err != nil {
+		return 0, err
+	}
+	return c.rollout(cap, apps), nil
+}
+
+// recordRevision stores the Cap's spec as new revision, if it differs from the latest one, and prunes revisions
+// neither recent nor used by any App.
+func (c *capReleaser) recordRevision(ctx context.Context, owner v1.Object, cap *shipcapsv1beta1.Cap, namespace string, apps []shipcapsv1beta1.App) error {
+	hash, err := cap.Spec.RevisionHash()
+	if err != nil {
+		return err
+	}
+	revisions := cap.Status.Revisions
+	if len(revisions) > 0 && revisions[len(revisions)-1].Hash == hash {
+		return nil
+	}
+
+	data, err := json.Marshal(cap.Spec)
+	if err != nil {
+		return err
+	}
+	revision := cap.Status.Revision + 1
+	cr := appsv1.ControllerRevision{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      capRevisionName(cap, revision),
+			Namespace: namespace,
+			Labels: map[string]string{
+				CapRevisionLabel:     cap.Name,
+				CapRevisionKindLabel: cap.KindName(),
+			},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}
+	if err := controllerutil.SetControllerReference(owner, &cr, c.Scheme); err != nil {
+		return err
+	}
+	// The cache might not have caught up with a revision we just recorded, in which case it holds the same spec.
+	if err := c.Create(ctx, &cr); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	strategy := shipcapsv1beta1.AllAtOnceRolloutStrategy
+	if cap.Spec.Rollout != nil && cap.Spec.Rollout.Strategy != "" {
+		strategy = cap.Spec.Rollout.Strategy
+	}
+	cap.Status.Revision = revision
+	cap.Status.Revisions = append(revisions, shipcapsv1beta1.CapRevision{
+		Revision:   revision,
+		Version:    cap.Spec.Version,
+		Generation: cap.Generation,
+		Hash:       hash,
+	})
+	// There is nothing to roll out gradually for the first revision.
+	cap.Status.Rollout = &shipcapsv1beta1.CapRollout{
+		Revision: revision,
+		Complete: len(revisions) == 0 || strategy == shipcapsv1beta1.AllAtOnceRolloutStrategy,
+	}
+
+	// Prune old revisions, but keep those still used by Apps.
+	used := make(map[int64]bool)
+	for _, app := range apps {
+		used[app.Status.CapRevision] = true
+	}
+	var kept []shipcapsv1beta1.CapRevision
+	for i, rev := range cap.Status.Revisions {
+		if i >= len(cap.Status.Revisions)-capRevisionHistoryLimit || used[rev.Revision] {
+			kept = append(kept, rev)
+			continue
+		}
+		old := appsv1.ControllerRevision{ObjectMeta: v1.ObjectMeta{Namespace: namespace, Name: capRevisionName(cap, rev.Revision)}}
+		if err := c.Delete(ctx, &old); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	cap.Status.Revisions = kept
+
+	return nil
+}
+
+// rollout advances the rollout of the Cap's latest revision by one step, if all Apps admitted so far are Ready on
+// that revision. Returns the remaining pause, if the next step has to wait.
+func (c *capReleaser) rollout(cap *shipcapsv1beta1.Cap, apps []shipcapsv1beta1.App) time.Duration {
+	rollout := cap.Status.Rollout
+	if rollout == nil || rollout.Complete {
+		return 0
+	}
+	policy := shipcapsv1beta1.RolloutPolicy{}
+	if cap.Spec.Rollout != nil {
+		policy = *cap.Spec.Rollout
+	}
+
+	// Only Apps whose version range includes the revision take part in the rollout.
+	var pending []shipcapsv1beta1.App
+	total := 0
+	for i := range apps {
+		app := &apps[i]
+		candidates, err := cap.CandidateRevisions(app)
+		if err != nil || len(candidates) == 0 || candidates[len(candidates)-1].Revision != rollout.Revision {
+			continue
+		}
+		total++
+		if !rollout.Admits(app) {
+			pending = append(pending, *app)
+			continue
+		}
+		if !appReadyOnRevision(app, rollout.Revision) {
+			rollout.Message = fmt.Sprintf("waiting for app '%s' to become ready on revision %d", app.AppKey(), rollout.Revision)
+			return 0
+		}
+	}
+
+	if len(pending) == 0 {
+		rollout.Complete = true
+		rollout.Message = fmt.Sprintf("all %d apps updated to revision %d", total, rollout.Revision)
+		return 0
+	}
+	if rollout.LastStep != nil && policy.Pause != nil {
+		if remaining := time.Until(rollout.LastStep.Add(policy.Pause.Duration)); remaining > 0 {
+			rollout.Message = fmt.Sprintf("pausing before updating the next apps to revision %d", rollout.Revision)
+			return remaining
+		}
+	}
+
+	// All Apps admitted so far are Ready on the revision, and stay admitted by using it.
+	step := rolloutStep(policy, total, len(pending))
+	rollout.UpdatedApps = nil
+	for _, app := range pending[:step] {
+		rollout.UpdatedApps = append(rollout.UpdatedApps, app.AppKey())
+	}
+	now := v1.Now()
+	rollout.LastStep = &now
+	rollout.Message = fmt.Sprintf("%d of %d apps updating to revision %d", total-len(pending)+step, total, rollout.Revision)
+	return 0
+}
+
+// rolloutStep returns the number of pending Apps to update in the next step of a rollout of total Apps. Percentages
+// are of the total and rounded up, and every step updates at least one App.
+func rolloutStep(policy shipcapsv1beta1.RolloutPolicy, total, pending int) int {
+	step := pending
+	switch policy.Strategy {
+	case shipcapsv1beta1.BatchRolloutStrategy:
+		step = int(policy.BatchSize)
+	case shipcapsv1beta1.PercentageRolloutStrategy:
+		step = (total*int(policy.Percentage) + 99) / 100
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > pending {
+		step = pending
+	}
+	return step
+}
+
+// appReadyOnRevision returns true if the App has been reconciled successfully with the given Cap revision
+func appReadyOnRevision(app *shipcapsv1beta1.App, revision int64) bool {
+	if app.Status.CapRevision != revision || app.Status.ObservedGeneration != app.Generation {
+		return false
+	}
+	cond := app.GetCondition(shipcapsv1beta1.AppReady)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+// capForApp maps an App to the Cap (or ClusterCap, if cluster is true) it references
+func capForApp(cluster bool) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		app, ok := obj.Object.(*shipcapsv1beta1.App)
+		if !ok {
+			return nil
+		}
+		if cluster && app.Spec.ClusterCapRef != nil {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: app.Spec.ClusterCapRef.Name}}}
+		}
+		if !cluster && app.Spec.CapRef != nil {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: app.Spec.CapRef.Namespace, Name: app.Spec.CapRef.Name}}}
+		}
+		return nil
+	}
+}
+
+// loadCapRevision reads the Cap's spec of the given revision. ClusterCap revisions are read from clusterNamespace.
+func loadCapRevision(ctx context.Context, c client.Reader, cap *shipcapsv1beta1.Cap, revision int64, clusterNamespace string) (*shipcapsv1beta1.CapSpec, error) {
+	namespace := cap.Namespace
+	if namespace == "" {
+		namespace = clusterNamespace
+	}
+	cr := appsv1.ControllerRevision{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: capRevisionName(cap, revision)}, &cr); err != nil {
+		return nil, fmt.Errorf("unable to get revision %d of %s '%s': %w", revision, cap.KindName(), cap.Name, err)
+	}
+	spec := shipcapsv1beta1.CapSpec{}
+	if err := json.Unmarshal(cr.Data.Raw, &spec); err != nil {
+		return nil, fmt.Errorf("unable to decode revision %d of %s '%s': %w", revision, cap.KindName(), cap.Name, err)
+	}
+	return &spec, nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+func TestRolloutStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  shipcapsv1beta1.RolloutPolicy
+		total   int
+		pending int
+		want    int
+	}{
+		{name: "all at once", policy: shipcapsv1beta1.RolloutPolicy{}, total: 10, pending: 7, want: 7},
+		{name: "batch", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.BatchRolloutStrategy, BatchSize: 3}, total: 10, pending: 7, want: 3},
+		{name: "last batch", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.BatchRolloutStrategy, BatchSize: 3}, total: 10, pending: 1, want: 1},
+		{name: "batch without size", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.BatchRolloutStrategy}, total: 10, pending: 7, want: 1},
+		{name: "percentage of total", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.PercentageRolloutStrategy, Percentage: 20}, total: 10, pending: 7, want: 2},
+		{name: "percentage rounded up", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.PercentageRolloutStrategy, Percentage: 25}, total: 3, pending: 3, want: 1},
+		{name: "percentage of few apps", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.PercentageRolloutStrategy, Percentage: 1}, total: 2, pending: 2, want: 1},
+		{name: "percentage capped at pending", policy: shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.PercentageRolloutStrategy, Percentage: 50}, total: 10, pending: 2, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolloutStep(tt.policy, tt.total, tt.pending); got != tt.want {
+				t.Errorf("rolloutStep() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapRevisionName(t *testing.T) {
+	cap := &shipcapsv1beta1.Cap{ObjectMeta: v1.ObjectMeta{Name: "clustercap-web", Namespace: "shipcaps-system"}}
+	clusterCap := &shipcapsv1beta1.Cap{ObjectMeta: v1.ObjectMeta{Name: "web"}}
+
+	if got := capRevisionName(cap, 1); got != "clustercap-web-1" {
+		t.Errorf("capRevisionName() of Cap = %s", got)
+	}
+	if got := capRevisionName(clusterCap, 1); got != "web-1.clustercap" {
+		t.Errorf("capRevisionName() of ClusterCap = %s", got)
+	}
+}
+
+func TestRolloutListsOnlyCurrentStep(t *testing.T) {
+	cap := &shipcapsv1beta1.Cap{
+		ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "platform"},
+		Spec: shipcapsv1beta1.CapSpec{
+			Rollout: &shipcapsv1beta1.RolloutPolicy{Strategy: shipcapsv1beta1.BatchRolloutStrategy, BatchSize: 2},
+		},
+		Status: shipcapsv1beta1.CapStatus{
+			Revisions: []shipcapsv1beta1.CapRevision{{Revision: 1}, {Revision: 2}},
+			Rollout:   &shipcapsv1beta1.CapRollout{Revision: 2},
+		},
+	}
+	var apps []shipcapsv1beta1.App
+	for _, name := range []string{"a", "b", "c", "d"} {
+		app := shipcapsv1beta1.App{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "team-a"}}
+		app.Status.CapRevision = 1
+		apps = append(apps, app)
+	}
+	// update lets the admitted Apps update to the revision, and become Ready on it
+	update := func() {
+		for i := range apps {
+			if cap.Status.Rollout.Admits(&apps[i]) {
+				apps[i].Status.CapRevision = 2
+				apps[i].SetCondition(shipcapsv1beta1.AppReady, corev1.ConditionTrue, "", "")
+			}
+		}
+	}
+	c := &capReleaser{}
+
+	c.rollout(cap, apps)
+	if got := cap.Status.Rollout.UpdatedApps; !reflect.DeepEqual(got, []string{"team-a/a", "team-a/b"}) {
+		t.Fatalf("first step admitted %v", got)
+	}
+	update()
+	c.rollout(cap, apps)
+	if got := cap.Status.Rollout.UpdatedApps; !reflect.DeepEqual(got, []string{"team-a/c", "team-a/d"}) {
+		t.Fatalf("second step admitted %v", got)
+	}
+	if !cap.Status.Rollout.Admits(&apps[0]) {
+		t.Errorf("apps updated in the first step must stay admitted")
+	}
+	update()
+	c.rollout(cap, apps)
+	if !cap.Status.Rollout.Complete {
+		t.Errorf("rollout should be complete: %s", cap.Status.Rollout.Message)
+	}
+}
@@ -22,8 +22,10 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -35,10 +37,14 @@ type CapDepReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// Recorder records events for CapDeps
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capdeps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=capdeps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *CapDepReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -64,13 +70,13 @@ func (r *CapDepReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		mans := src.InLine
 		unstruct := []unstructured.Unstructured{}
 		if err := json.Unmarshal(mans, &unstruct); err != nil {
+			if r.Recorder != nil {
+				r.Recorder.Event(&capdep, corev1.EventTypeWarning, InvalidSourceEventReason, fmt.Sprintf("inline manifests can't be decoded: %s", err))
+			}
 			return ctrl.Result{}, err
 		}
 		for _, man := range unstruct {
-			fmt.Println(fmt.Sprintf("Resource: %s | Name: %s", man.GroupVersionKind().String(), man.GetName()))
-			//if err := r.Client.Create(ctx, &man, client.DryRunAll); err != nil {
-			//	return ctrl.Result{}, err
-			//}
+			log.V(1).Info(fmt.Sprintf("Resource: %s | Name: %s", man.GroupVersionKind().String(), man.GetName()))
 		}
 	}
 
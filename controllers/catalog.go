@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// CatalogFilter selects the Caps and ClusterCaps listed in the catalog. Empty fields select all of them.
+type CatalogFilter struct {
+	// Query is searched for in the name, display name, description and tags, ignoring case
+	Query string
+
+	// Kind is either Cap or ClusterCap
+	Kind string
+
+	// Namespace of the Caps. ClusterCaps are not listed if set.
+	Namespace string
+
+	// Tags the Caps must all be tagged with
+	Tags []string
+
+	// Maturity of the Caps
+	Maturity shipcapsv1beta1.CapMaturity
+
+	// Owner of the Caps
+	Owner string
+
+	// Consumer selects the Caps that Apps in this namespace may use
+	Consumer string
+}
+
+// CatalogEntry describes a Cap or ClusterCap in the catalog
+type CatalogEntry struct {
+	// Kind is either Cap or ClusterCap
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+
+	// Version is the current version of the Cap
+	Version string `json:"version,omitempty"`
+
+	shipcapsv1beta1.CapCatalog `json:",inline"`
+
+	// Inputs are the inputs Apps of the Cap set
+	Inputs shipcapsv1beta1.CapInputs `json:"inputs,omitempty"`
+
+	// Apps is the number of Apps using the Cap
+	Apps int32 `json:"apps"`
+
+	// Examples are example Apps using the Cap
+	Examples []shipcapsv1beta1.App `json:"examples"`
+}
+
+// Catalog lists all Caps and ClusterCaps selected by the filter, sorted by kind, namespace and name. Example Apps are
+// put into the consumer namespace of the filter if given, or the Cap's namespace otherwise ("default" for
+// ClusterCaps).
+func Catalog(ctx context.Context, c client.Reader, filter CatalogFilter) ([]CatalogEntry, error) {
+	var caps []shipcapsv1beta1.Cap
+	if filter.Kind == "" || filter.Kind == "ClusterCap" {
+		if filter.Namespace == "" {
+			var clusterCaps shipcapsv1beta1.ClusterCapList
+			if err := c.List(ctx, &clusterCaps); err != nil {
+				return nil, fmt.Errorf("unable to list ClusterCaps: %w", err)
+			}
+			for _, clusterCap := range clusterCaps.Items {
+				caps = append(caps, shipcapsv1beta1.Cap(clusterCap))
+			}
+		}
+	}
+	if filter.Kind == "" || filter.Kind == "Cap" {
+		var list shipcapsv1beta1.CapList
+		if err := c.List(ctx, &list, client.InNamespace(filter.Namespace)); err != nil {
+			return nil, fmt.Errorf("unable to list Caps: %w", err)
+		}
+		caps = append(caps, list.Items...)
+	}
+
+	entries := []CatalogEntry{}
+	for i := range caps {
+		cap := &caps[i]
+		ok, err := filter.matches(ctx, c, cap)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		namespace := filter.Consumer
+		if namespace == "" {
+			namespace = cap.Namespace
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+		examples, err := cap.ExampleApps(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate example apps of %s '%s': %w", cap.KindName(), cap.CapKey(), err)
+		}
+		entry := CatalogEntry{
+			Kind:       cap.KindName(),
+			Namespace:  cap.Namespace,
+			Name:       cap.Name,
+			Version:    cap.Spec.Version,
+			CapCatalog: cap.GetCatalog(),
+			Inputs:     cap.Spec.Inputs,
+			Examples:   examples,
+		}
+		if cap.Status.Usage != nil {
+			entry.Apps = cap.Status.Usage.Apps
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// matches returns true if the filter selects the given Cap
+func (filter *CatalogFilter) matches(ctx context.Context, c client.Reader, cap *shipcapsv1beta1.Cap) (bool, error) {
+	catalog := cap.GetCatalog()
+	if filter.Query != "" && !cap.MatchesSearch(filter.Query) {
+		return false, nil
+	}
+	for _, tag := range filter.Tags {
+		if !cap.HasTag(tag) {
+			return false, nil
+		}
+	}
+	if filter.Maturity != "" && filter.Maturity != catalog.Maturity {
+		return false, nil
+	}
+	if filter.Owner != "" && !strings.EqualFold(filter.Owner, catalog.Owner) {
+		return false, nil
+	}
+	if filter.Consumer != "" {
+		consumer := shipcapsv1beta1.App{}
+		consumer.Namespace = filter.Consumer
+		if err := cap.CheckConsumer(ctx, c, &consumer); err != nil {
+			return false, ignoreNotAllowed(err)
+		}
+	}
+	return true, nil
+}
+
+// ignoreNotAllowed returns nil if the error is a CapNotAllowed error
+func ignoreNotAllowed(err error) error {
+	if errors.IsErr(err, errors.CapNotAllowedCode) {
+		return nil
+	}
+	return err
+}
+
+// CatalogHandler serves the catalog on GET requests. The query parameters q, kind, namespace, tag (repeatable),
+// maturity, owner and consumer filter the Caps. The catalog is returned as JSON.
+func CatalogHandler(c client.Reader, log logr.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := req.URL.Query()
+		filter := CatalogFilter{
+			Query:     query.Get("q"),
+			Kind:      query.Get("kind"),
+			Namespace: query.Get("namespace"),
+			Tags:      query["tag"],
+			Maturity:  shipcapsv1beta1.CapMaturity(query.Get("maturity")),
+			Owner:     query.Get("owner"),
+			Consumer:  query.Get("consumer"),
+		}
+		if filter.Kind != "" && filter.Kind != "Cap" && filter.Kind != "ClusterCap" {
+			http.Error(w, "kind must be Cap or ClusterCap", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := Catalog(req.Context(), c, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			log.Error(err, "unable to write catalog response")
+		}
+	})
+}
+
+// CatalogServer serves the catalog of Caps and ClusterCaps at /catalog. It is meant to be added to the manager.
+type CatalogServer struct {
+	// Addr is the address to listen on
+	Addr string
+
+	// Client reads the Caps and ClusterCaps
+	Client client.Reader
+
+	// Log logs failed responses
+	Log logr.Logger
+}
+
+// Start runs the server until the stop channel is closed
+func (s *CatalogServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/catalog", CatalogHandler(s.Client, s.Log))
+	return serve(s.Addr, "", mux, stop)
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+func TestCatalog(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+
+	spec := func(catalog shipcapsv1beta1.CapCatalog, consumers *shipcapsv1beta1.CapConsumers) shipcapsv1beta1.CapSpec {
+		return shipcapsv1beta1.CapSpec{Catalog: &catalog, Consumers: consumers}
+	}
+	internal := &v1.LabelSelector{MatchLabels: map[string]string{"tier": "internal"}}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tier": "internal"}}},
+		&shipcapsv1beta1.ClusterCap{
+			ObjectMeta: v1.ObjectMeta{Name: "postgres"},
+			Spec:       spec(shipcapsv1beta1.CapCatalog{Tags: []string{"database"}, Maturity: shipcapsv1beta1.StableCapMaturity}, nil),
+		},
+		&shipcapsv1beta1.ClusterCap{
+			ObjectMeta: v1.ObjectMeta{Name: "internal"},
+			Spec:       spec(shipcapsv1beta1.CapCatalog{}, &shipcapsv1beta1.CapConsumers{NamespaceSelector: internal}),
+		},
+		&shipcapsv1beta1.Cap{
+			ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "platform"},
+			Spec:       spec(shipcapsv1beta1.CapCatalog{Tags: []string{"web"}, Owner: "platform"}, &shipcapsv1beta1.CapConsumers{Namespaces: []string{"team-*"}}),
+		},
+		// The invalid selector makes the consumer check fail, which just leaves the Cap out.
+		&shipcapsv1beta1.Cap{
+			ObjectMeta: v1.ObjectMeta{Name: "broken", Namespace: "platform"},
+			Spec: spec(shipcapsv1beta1.CapCatalog{}, &shipcapsv1beta1.CapConsumers{NamespaceSelector: &v1.LabelSelector{
+				MatchExpressions: []v1.LabelSelectorRequirement{{Key: "tier", Operator: "Matches"}},
+			}}),
+		},
+		&shipcapsv1beta1.Cap{
+			ObjectMeta: v1.ObjectMeta{Name: "cache", Namespace: "team-a"},
+			Spec:       spec(shipcapsv1beta1.CapCatalog{}, nil),
+		},
+	)
+
+	tests := []struct {
+		name     string
+		filter   CatalogFilter
+		want     []string
+		examples string
+	}{
+		{
+			name:   "all",
+			filter: CatalogFilter{},
+			want:   []string{"Cap platform/broken", "Cap platform/web", "Cap team-a/cache", "ClusterCap /internal", "ClusterCap /postgres"},
+		},
+		{name: "namespace", filter: CatalogFilter{Namespace: "platform"}, want: []string{"Cap platform/broken", "Cap platform/web"}},
+		{name: "kind", filter: CatalogFilter{Kind: "ClusterCap"}, want: []string{"ClusterCap /internal", "ClusterCap /postgres"}},
+		{
+			name:     "consumer by pattern and labels",
+			filter:   CatalogFilter{Consumer: "team-b"},
+			want:     []string{"Cap platform/web", "Cap team-a/cache", "ClusterCap /internal", "ClusterCap /postgres"},
+			examples: "team-b",
+		},
+		{
+			name:     "consumer without labels",
+			filter:   CatalogFilter{Consumer: "default"},
+			want:     []string{"Cap team-a/cache", "ClusterCap /postgres"},
+			examples: "default",
+		},
+		{name: "namespace and consumer", filter: CatalogFilter{Namespace: "platform", Consumer: "default"}, want: []string{}},
+		{name: "query", filter: CatalogFilter{Query: "WEB"}, want: []string{"Cap platform/web"}},
+		{name: "tags", filter: CatalogFilter{Tags: []string{"Database"}}, want: []string{"ClusterCap /postgres"}},
+		{name: "maturity", filter: CatalogFilter{Maturity: shipcapsv1beta1.StableCapMaturity}, want: []string{"ClusterCap /postgres"}},
+		{name: "owner", filter: CatalogFilter{Owner: "Platform"}, want: []string{"Cap platform/web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Catalog(context.Background(), c, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, entry := range entries {
+				got = append(got, fmt.Sprintf("%s %s/%s", entry.Kind, entry.Namespace, entry.Name))
+
+				// Examples go into the consumer namespace, or the Cap's namespace ("default" for ClusterCaps).
+				examples := tt.examples
+				if examples == "" {
+					examples = entry.Namespace
+				}
+				if examples == "" {
+					examples = "default"
+				}
+				if len(entry.Examples) != 1 || entry.Examples[0].Namespace != examples {
+					t.Errorf("%s '%s' has examples %v, want one in namespace '%s'", entry.Kind, entry.Name, entry.Examples, examples)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Catalog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreNotAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "no error"},
+		{name: "not allowed", err: errors.NewShipCapsError(errors.CapNotAllowedCode, "not allowed")},
+		{name: "wrapped not allowed", err: fmt.Errorf("check: %w", errors.NewShipCapsError(errors.CapNotAllowedCode, "not allowed"))},
+		{name: "other code", err: errors.NewShipCapsError(errors.CapNotFoundCode, "not found"), wantErr: true},
+		{name: "plain error", err: fmt.Errorf("unable to get namespace"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ignoreNotAllowed(tt.err); (err != nil) != tt.wantErr {
+				t.Errorf("ignoreNotAllowed() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -18,11 +18,17 @@ package controllers
 
 import (
 	"context"
+	"reflect"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
 )
@@ -32,22 +38,68 @@ type ClusterCapReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// Recorder records events for ClusterCaps
+	Recorder record.EventRecorder
+
+	// RevisionNamespace is the namespace the revisions of ClusterCaps are stored in
+	RevisionNamespace string
 }
 
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=clustercaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=clustercaps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=apps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *ClusterCapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
-	_ = r.Log.WithValues("clustercap", req.NamespacedName)
+	ctx := context.Background()
+	log := r.Log.WithValues("clustercap", req.NamespacedName)
+
+	var clusterCap shipcapsv1beta1.ClusterCap
+	if err := r.Get(ctx, req.NamespacedName, &clusterCap); err != nil {
+		log.V(1).Info("unable to fetch ClusterCap")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	status := clusterCap.Status.DeepCopy()
+
+	cap := shipcapsv1beta1.Cap(clusterCap)
+	cap.Status.ObservedGeneration = cap.Generation
+	if err := reconcilePolicies(ctx, r.Client, &cap); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := reconcileUsage(ctx, r.Client, &cap); err != nil {
+		return ctrl.Result{}, err
+	}
+	releaser := capReleaser{Client: r.Client, Scheme: r.Scheme}
+	requeue, err := releaser.reconcile(ctx, &clusterCap, &cap, r.RevisionNamespace)
+	if err != nil {
+		if r.Recorder != nil {
+			r.Recorder.Event(&clusterCap, corev1.EventTypeWarning, ReconcileFailedEventReason, err.Error())
+		}
+		return ctrl.Result{}, err
+	}
 
-	// your logic here
+	clusterCap.Status = cap.Status
+	if !reflect.DeepEqual(status, &clusterCap.Status) {
+		recordCapEvents(r.Recorder, &clusterCap, status, &clusterCap.Status)
+		if err := r.Status().Update(ctx, &clusterCap); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeue}, nil
 }
 
 func (r *ClusterCapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&shipcapsv1beta1.ClusterCap{}).
+		Owns(&appsv1.ControllerRevision{}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.App{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: capForApp(true),
+		}).
+		Watches(&source.Kind{Type: &shipcapsv1beta1.CapPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: capsForPolicy(mgr.GetClient(), r.Log, true),
+		}).
 		Complete(r)
 }
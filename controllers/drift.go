@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// RenderHashAnnotation holds the hash of the rendered object, as it was last applied by shipcaps. It's used to tell
+// changes of the rendered object apart from out-of-band changes of the live object.
+const RenderHashAnnotation = "shipcaps.redradrat.xyz/render-hash"
+
+// renderHash returns a hash of the given object content
+func renderHash(obj map[string]interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// driftedFields compares the object as it would be after applying the rendered object with the live object, and
+// returns the paths of all fields that differ. The applied object is the result of a dry-run apply, so defaults and
+// canonical forms the apiserver sets (e.g. of quantities) are on both sides, and only fields our apply would change
+// differ. Of the metadata only labels and annotations are compared, and the status is ignored completely.
+func driftedFields(applied, live map[string]interface{}) []string {
+	var fields []string
+	for _, key := range unionKeys(applied, live) {
+		switch key {
+		case "status":
+			continue
+		case "metadata":
+			appliedMeta, _ := applied[key].(map[string]interface{})
+			liveMeta, _ := live[key].(map[string]interface{})
+			for _, metaKey := range []string{"labels", "annotations"} {
+				fields = append(fields, diffValue(".metadata."+metaKey, appliedMeta[metaKey], liveMeta[metaKey])...)
+			}
+		default:
+			fields = append(fields, diffValue("."+key, applied[key], live[key])...)
+		}
+	}
+	return fields
+}
+
+// diffValue recursively compares an applied and a live value, and returns the paths of the differing fields
+func diffValue(path string, applied, live interface{}) []string {
+	switch typedApplied := applied.(type) {
+	case map[string]interface{}:
+		typedLive, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{path}
+		}
+		var fields []string
+		for _, key := range unionKeys(typedApplied, typedLive) {
+			fields = append(fields, diffValue(path+"."+key, typedApplied[key], typedLive[key])...)
+		}
+		return fields
+	case []interface{}:
+		typedLive, ok := live.([]interface{})
+		if !ok || len(typedLive) != len(typedApplied) {
+			return []string{path}
+		}
+		var fields []string
+		for i := range typedApplied {
+			fields = append(fields, diffValue(fmt.Sprintf("%s[%d]", path, i), typedApplied[i], typedLive[i])...)
+		}
+		return fields
+	default:
+		if !reflect.DeepEqual(normalizeValue(applied), normalizeValue(live)) {
+			return []string{path}
+		}
+		return nil
+	}
+}
+
+// unionKeys returns the keys of both maps, sorted
+func unionKeys(a, b map[string]interface{}) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeValue converts all numbers to float64, as objects decoded from JSON may hold integers as float64, but
+// live objects hold them as int64.
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case int32:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	default:
+		return value
+	}
+}
+
+// managedByOthers returns the paths of the fields of the live object that are managed by field managers other than
+// ours. Fields of list entries are represented by the path of their list, as list entries are identified differently
+// in managed fields.
+func managedByOthers(live *unstructured.Unstructured) []string {
+	var paths []string
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager == FieldManager || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		paths = append(paths, managedPaths("", fields)...)
+	}
+	return paths
+}
+
+// managedPaths returns the paths of the leaf fields of the given managed fields set, prefixed with the given path
+func managedPaths(prefix string, fields map[string]interface{}) []string {
+	var paths []string
+	for key, value := range fields {
+		switch {
+		case key == ".":
+			// The field itself is part of the set, which its children already tell.
+		case strings.HasPrefix(key, "f:"):
+			path := prefix + "." + strings.TrimPrefix(key, "f:")
+			children, _ := value.(map[string]interface{})
+			if len(children) == 0 || (len(children) == 1 && children["."] != nil) {
+				paths = append(paths, path)
+				continue
+			}
+			paths = append(paths, managedPaths(path, children)...)
+		default:
+			// A list entry, identified by key ("k:"), value ("v:") or index ("i:")
+			paths = append(paths, prefix)
+		}
+	}
+	return paths
+}
+
+// conflictFields returns the fields of the given conflicts that concern the object
+func conflictFields(conflicts []shipcapsv1beta1.AppObjectConflict, obj *unstructured.Unstructured) []string {
+	var fields []string
+	for _, conflict := range conflicts {
+		if conflict.APIVersion == obj.GetAPIVersion() && conflict.Kind == obj.GetKind() &&
+			conflict.Namespace == obj.GetNamespace() && conflict.Name == obj.GetName() {
+			fields = append(fields, conflict.Fields...)
+		}
+	}
+	return fields
+}
+
+// coversField returns true if any of the given paths is the field, or a parent or child of it
+func coversField(paths []string, field string) bool {
+	related := func(parent, child string) bool {
+		return strings.HasPrefix(child, parent+".") || strings.HasPrefix(child, parent+"[")
+	}
+	for _, path := range paths {
+		if path == field || related(path, field) || related(field, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownershipPath returns the path to take ownership of for the given drifted field. As list entries are identified
+// differently by the apiserver, we take over the whole list.
+func ownershipPath(field string) string {
+	return strings.SplitN(field, "[", 2)[0]
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+func TestDriftedFields(t *testing.T) {
+	deployment := func(cpu interface{}, replicas interface{}, containers ...map[string]interface{}) map[string]interface{} {
+		list := []interface{}{}
+		for _, c := range containers {
+			c["resources"] = map[string]interface{}{"requests": map[string]interface{}{"cpu": cpu}}
+			list = append(list, c)
+		}
+		return map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":   "web",
+				"labels": map[string]interface{}{"app": "web"},
+			},
+			"spec": map[string]interface{}{
+				"replicas": replicas,
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": list},
+				},
+			},
+		}
+	}
+	// A container as the apiserver returns it, with defaulted fields
+	defaulted := func(image string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":                     "web",
+			"image":                    image,
+			"imagePullPolicy":          "IfNotPresent",
+			"terminationMessagePath":   "/dev/termination-log",
+			"terminationMessagePolicy": "File",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		applied map[string]interface{}
+		live    map[string]interface{}
+		want    []string
+	}{
+		{
+			name:    "canonical quantities and defaulted list items",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("500m", int64(2), defaulted("nginx:1.17")),
+		},
+		{
+			name:    "numbers decoded from JSON",
+			applied: deployment("1", float64(2), defaulted("nginx:1.17")),
+			live:    deployment("1", int64(2), defaulted("nginx:1.17")),
+		},
+		{
+			name:    "changed value",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("500m", int64(5), defaulted("nginx:1.17")),
+			want:    []string{".spec.replicas"},
+		},
+		{
+			name:    "changed list item",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("500m", int64(2), defaulted("nginx:latest")),
+			want:    []string{".spec.template.spec.containers[0].image"},
+		},
+		{
+			name:    "added list item",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("500m", int64(2), defaulted("nginx:1.17"), defaulted("sidecar")),
+			want:    []string{".spec.template.spec.containers"},
+		},
+		{
+			name:    "changed quantity",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("1", int64(2), defaulted("nginx:1.17")),
+			want:    []string{".spec.template.spec.containers[0].resources.requests.cpu"},
+		},
+		{
+			name:    "removed field",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live:    deployment("500m", nil, defaulted("nginx:1.17")),
+			want:    []string{".spec.replicas"},
+		},
+		{
+			name:    "changed label",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live: func() map[string]interface{} {
+				obj := deployment("500m", int64(2), defaulted("nginx:1.17"))
+				obj["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"app": "other"}
+				return obj
+			}(),
+			want: []string{".metadata.labels.app"},
+		},
+		{
+			name:    "other metadata and status",
+			applied: deployment("500m", int64(2), defaulted("nginx:1.17")),
+			live: func() map[string]interface{} {
+				obj := deployment("500m", int64(2), defaulted("nginx:1.17"))
+				obj["metadata"].(map[string]interface{})["resourceVersion"] = "42"
+				obj["status"] = map[string]interface{}{"replicas": int64(2)}
+				return obj
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := driftedFields(tt.applied, tt.live); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("driftedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{in: 3, want: float64(3)},
+		{in: int32(3), want: float64(3)},
+		{in: int64(3), want: float64(3)},
+		{in: 1.5, want: 1.5},
+		{in: "500m", want: "500m"},
+		{in: true, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeValue(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeValue(%#v) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// fakeApplyClient emulates server-side apply on the fake client, which doesn't support it, with merge patches
+type fakeApplyClient struct {
+	client.Client
+	applies int
+}
+
+func (c *fakeApplyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if len(patchOpts.DryRun) > 0 {
+		return nil
+	}
+	c.applies++
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, mergePatch(data))
+}
+
+// mergePatch is a JSON merge patch with the given data
+type mergePatch []byte
+
+func (p mergePatch) Type() types.PatchType {
+	return types.MergePatchType
+}
+
+func (p mergePatch) Data(runtime.Object) ([]byte, error) {
+	return p, nil
+}
+
+func TestApplyRenderedLeavesFieldsOfOtherManagers(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+
+	rendered := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+			"spec":       map[string]interface{}{"replicas": int64(2)},
+		}}
+	}
+	hash, err := renderHash(rendered().Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		force    []shipcapsv1beta1.FieldSelector
+		replicas int32
+	}{
+		{name: "taken over by the autoscaler", replicas: 5},
+		{
+			name:     "forced",
+			force:    []shipcapsv1beta1.FieldSelector{{Kind: "Deployment", Paths: []string{".spec.replicas"}}},
+			replicas: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The autoscaler scaled the Deployment we applied, and manages its replicas since.
+			live := rendered()
+			live.SetAnnotations(map[string]string{RenderHashAnnotation: hash})
+			live.SetManagedFields([]v1.ManagedFieldsEntry{
+				{Manager: FieldManager, Operation: v1.ManagedFieldsOperationApply, FieldsV1: &v1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{"f:shipcaps.redradrat.xyz/render-hash":{}}}}`)}},
+				{Manager: "kube-controller-manager", Operation: v1.ManagedFieldsOperationUpdate, FieldsV1: &v1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)}},
+			})
+			if err := unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas"); err != nil {
+				t.Fatal(err)
+			}
+			app := &shipcapsv1beta1.App{ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"}}
+			c := &fakeApplyClient{Client: fake.NewFakeClientWithScheme(scheme, app, live)}
+			r := &AppReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+			// Reconcile twice, so a correction would have to survive the next comparison as well.
+			for i := 0; i < 2; i++ {
+				if err := r.applyRendered(ctx, c, app, rendered(), ApplyPolicy{ForceOwnership: tt.force}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deployment := appsv1.Deployment{}
+			if err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web"}, &deployment); err != nil {
+				t.Fatal(err)
+			}
+			if *deployment.Spec.Replicas != tt.replicas {
+				t.Errorf("replicas = %d, want %d", *deployment.Spec.Replicas, tt.replicas)
+			}
+			if forced := len(tt.force) > 0; forced != (c.applies == 1) {
+				t.Errorf("applied %d times", c.applies)
+			}
+			// Once corrected, the replicas don't drift anymore.
+			if forced := len(tt.force) > 0; forced != (len(app.Status.Drift) == 1) {
+				t.Errorf("drift = %+v", app.Status.Drift)
+			}
+		})
+	}
+}
+
+func TestCoversField(t *testing.T) {
+	paths := managedPaths("", map[string]interface{}{
+		"f:metadata": map[string]interface{}{"f:labels": map[string]interface{}{".": map[string]interface{}{}, "f:team": map[string]interface{}{}}},
+		"f:spec": map[string]interface{}{
+			"f:replicas": map[string]interface{}{},
+			"f:template": map[string]interface{}{"f:spec": map[string]interface{}{"f:containers": map[string]interface{}{
+				`k:{"name":"web"}`: map[string]interface{}{"f:image": map[string]interface{}{}},
+			}}},
+		},
+	})
+
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{field: ".spec.replicas", want: true},
+		{field: ".metadata.labels.team", want: true},
+		{field: ".metadata.labels.app"},
+		{field: ".spec.template.spec.containers[0].image", want: true},
+		{field: ".spec.template.spec.containers", want: true},
+		{field: ".spec.template", want: true},
+		{field: ".spec.strategy"},
+		{field: ".spec.replicasExtra"},
+	}
+	for _, tt := range tests {
+		if got := coversField(paths, tt.field); got != tt.want {
+			t.Errorf("coversField(%s) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// Reasons of the events recorded by the reconcilers
+const (
+	// ReconcileFailedEventReason is used for failures without an error code. Failures with a code are recorded with
+	// the reason of the code.
+	ReconcileFailedEventReason = "ReconcileFailed"
+	// CreatedEventReason is used when a rendered object is created
+	CreatedEventReason = "Created"
+	// HelmReleaseCreatedEventReason is used when the HelmRelease of an App is created
+	HelmReleaseCreatedEventReason = "HelmReleaseCreated"
+	// UpdatedEventReason is used when a rendered object is updated
+	UpdatedEventReason = "Updated"
+	// PrunedEventReason is used when an object an App doesn't render anymore is deleted
+	PrunedEventReason = "Pruned"
+	// DriftDetectedEventReason is used when an applied object drifted, and the drift is only reported
+	DriftDetectedEventReason = "DriftDetected"
+	// DriftCorrectedEventReason is used when an applied object drifted, and the drift was corrected
+	DriftCorrectedEventReason = "DriftCorrected"
+	// ConflictEventReason is used when fields of a rendered object are managed by another field manager
+	ConflictEventReason = "Conflict"
+	// RevisionCreatedEventReason is used when a revision of an App or Cap is recorded
+	RevisionCreatedEventReason = "RevisionCreated"
+	// RevisionPrunedEventReason is used when a revision of an App or Cap is deleted
+	RevisionPrunedEventReason = "RevisionPruned"
+	// RolloutProgressingEventReason is used when the rollout of a Cap revision advances
+	RolloutProgressingEventReason = "RolloutProgressing"
+	// RolloutCompleteEventReason is used when all Apps of a Cap are updated to its latest revision
+	RolloutCompleteEventReason = "RolloutComplete"
+	// SuspendedEventReason is used when an App's reconciliation is suspended
+	SuspendedEventReason = "Suspended"
+	// ResumedEventReason is used when an App's reconciliation is resumed
+	ResumedEventReason = "Resumed"
+	// PolicyViolationEventReason is used when the manifests of a Cap violate a CapPolicy
+	PolicyViolationEventReason = "PolicyViolation"
+	// InvalidSourceEventReason is used when the source of a CapDep can't be read
+	InvalidSourceEventReason = "InvalidSource"
+)
+
+// failureReason returns the reason of the condition and event to report err with. It is the reason of the most
+// specific error code, or ReconcileFailedEventReason for errors without a code.
+func failureReason(err error) string {
+	if code, ok := errors.CodeOf(err); ok {
+		return code.Reason()
+	}
+	return ReconcileFailedEventReason
+}
+
+// recordCapEvents records events for the changes between the old and new status of a Cap or ClusterCap
+func recordCapEvents(recorder record.EventRecorder, obj runtime.Object, old, new *shipcapsv1beta1.CapStatus) {
+	if recorder == nil {
+		return
+	}
+	if new.Revision > old.Revision {
+		recorder.Event(obj, corev1.EventTypeNormal, RevisionCreatedEventReason, fmt.Sprintf("Recorded revision %d", new.Revision))
+	}
+	kept := make(map[int64]bool)
+	for _, rev := range new.Revisions {
+		kept[rev.Revision] = true
+	}
+	for _, rev := range old.Revisions {
+		if !kept[rev.Revision] {
+			recorder.Event(obj, corev1.EventTypeNormal, RevisionPrunedEventReason, fmt.Sprintf("Pruned revision %d", rev.Revision))
+		}
+	}
+
+	if len(new.PolicyViolations) > 0 && !reflect.DeepEqual(old.PolicyViolations, new.PolicyViolations) {
+		recorder.Event(obj, corev1.EventTypeWarning, PolicyViolationEventReason, strings.Join(new.PolicyViolations, "; "))
+	}
+
+	if new.Rollout == nil || new.Rollout.Message == "" {
+		return
+	}
+	if old.Rollout != nil && old.Rollout.Revision == new.Rollout.Revision && old.Rollout.Message == new.Rollout.Message {
+		return
+	}
+	reason := RolloutProgressingEventReason
+	if new.Rollout.Complete {
+		reason = RolloutCompleteEventReason
+	}
+	recorder.Event(obj, corev1.EventTypeNormal, reason, new.Rollout.Message)
+}
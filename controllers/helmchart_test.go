@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestRenderHelmChartCapTypeApp(t *testing.T) {
+	r := &AppReconciler{}
+	src := shipcapsv1beta1.CapSource{
+		Type: shipcapsv1beta1.HelmChartCapSourceType,
+		Repo: shipcapsv1beta1.RepoSpec{URI: "https://example.com/charts.git", Ref: "main", Path: "charts/web"},
+	}
+	app := shipcapsv1beta1.App{ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"}}
+	values := parsing.CapValues{
+		{TargetIdentifier: "image.tag", Value: "1.0"},
+		{TargetIdentifier: "replicas", Value: int64(2)},
+		{TargetIdentifier: "ingress", Value: nil},
+	}
+
+	obj, err := r.RenderHelmChartCapTypeApp(src, app, values, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "helm.fluxcd.io/v1",
+		"kind":       "HelmRelease",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"chart": map[string]interface{}{
+				"git":  "https://example.com/charts.git",
+				"ref":  "main",
+				"path": "charts/web",
+			},
+			"values": map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "1.0"},
+				"replicas": int64(2),
+				"ingress":  nil,
+			},
+		},
+	}
+	if !reflect.DeepEqual(obj.Object, want) {
+		t.Errorf("RenderHelmChartCapTypeApp() = %v, want %v", obj.Object, want)
+	}
+}
+
+func TestRemoveEmptyFields(t *testing.T) {
+	obj := map[string]interface{}{
+		"name":     "web",
+		"null":     nil,
+		"empty":    map[string]interface{}{},
+		"list":     []interface{}{},
+		"nested":   map[string]interface{}{"rollback": map[string]interface{}{"enable": nil}},
+		"zero":     int64(0),
+		"nonEmpty": map[string]interface{}{"a": "b", "c": nil},
+	}
+	removeEmptyFields(obj)
+	want := map[string]interface{}{
+		"name":     "web",
+		"zero":     int64(0),
+		"nonEmpty": map[string]interface{}{"a": "b"},
+	}
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("removeEmptyFields() = %v, want %v", obj, want)
+	}
+}
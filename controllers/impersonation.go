@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// +kubebuilder:rbac:groups="",resources=serviceaccounts;groups,verbs=impersonate
+
+// impersonatingClients caches a client per impersonated ServiceAccount, as building one discovers the API anew
+type impersonatingClients struct {
+	mu      sync.Mutex
+	clients map[string]client.Client
+}
+
+// serviceAccountName returns the name of the ServiceAccount the objects of the given App are applied as, or "" to
+// apply them with the operator's own identity
+func serviceAccountName(app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) string {
+	if app.Spec.ServiceAccountName != "" {
+		return app.Spec.ServiceAccountName
+	}
+	return cap.Spec.ServiceAccountName
+}
+
+// applyClient returns the client to apply the objects of the given App with. If the App or its Cap names a
+// ServiceAccount, the client impersonates that ServiceAccount of the App's namespace, so the objects are only applied
+// if its RBAC allows it.
+func (r *AppReconciler) applyClient(app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) (client.Client, error) {
+	if err := cap.CheckServiceAccount(app); err != nil {
+		return nil, err
+	}
+	name := serviceAccountName(app, cap)
+	if name == "" {
+		return r.Client, nil
+	}
+	if r.Config == nil {
+		return nil, fmt.Errorf("unable to impersonate ServiceAccount '%s/%s' without a rest config", app.Namespace, name)
+	}
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", app.Namespace, name)
+
+	r.impersonating.mu.Lock()
+	defer r.impersonating.mu.Unlock()
+	if c, ok := r.impersonating.clients[username]; ok {
+		return c, nil
+	}
+	cfg := rest.CopyConfig(r.Config)
+	cfg.Impersonate = rest.ImpersonationConfig{
+		UserName: username,
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:" + app.Namespace, "system:authenticated"},
+	}
+	c, err := client.New(cfg, client.Options{Scheme: r.Scheme, Mapper: r.RESTMapper})
+	if err != nil {
+		return nil, fmt.Errorf("unable to impersonate ServiceAccount '%s/%s': %w", app.Namespace, name, err)
+	}
+	if r.impersonating.clients == nil {
+		r.impersonating.clients = make(map[string]client.Client)
+	}
+	r.impersonating.clients[username] = c
+	return c, nil
+}
@@ -0,0 +1,450 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+// ObjectHealth is the health of a live object rendered for an App
+type ObjectHealth string
+
+const (
+	// HealthyObjectHealth is used for objects that exist and report to be ready
+	HealthyObjectHealth ObjectHealth = "Healthy"
+	// ProgressingObjectHealth is used for objects that exist, but are not ready yet
+	ProgressingObjectHealth ObjectHealth = "Progressing"
+	// DegradedObjectHealth is used for objects that report a failure
+	DegradedObjectHealth ObjectHealth = "Degraded"
+	// MissingObjectHealth is used for rendered objects that don't exist
+	MissingObjectHealth ObjectHealth = "Missing"
+	// UnknownObjectHealth is used for objects that can't be read
+	UnknownObjectHealth ObjectHealth = "Unknown"
+)
+
+// InventoryFilter selects the Apps listed in an inventory. Empty fields select all Apps.
+type InventoryFilter struct {
+	// Namespace of the Apps
+	Namespace string
+
+	// Cap selects Apps using the Cap with the given namespace/name, or the ClusterCap with the given name
+	Cap string
+
+	// Selector selects Apps by label
+	Selector labels.Selector
+}
+
+// Inventory lists Apps with their Cap, values and objects
+type Inventory struct {
+	Apps []InventoryApp `json:"apps"`
+}
+
+// InventoryApp describes an App and its parts, as of its current revision
+type InventoryApp struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	// CapKind is either Cap or ClusterCap
+	CapKind string `json:"capKind"`
+
+	// Cap is the namespace/name of the Cap, or the name of the ClusterCap
+	Cap string `json:"cap"`
+
+	// CapRevision is the revision of the Cap the App uses
+	CapRevision int64 `json:"capRevision,omitempty"`
+
+	// CapVersion is the version of the Cap the App uses
+	CapVersion string `json:"capVersion,omitempty"`
+
+	// Revision is the current revision of the App
+	Revision int64 `json:"revision,omitempty"`
+
+	// Ready is the status of the App's Ready condition, with its reason
+	Ready  corev1.ConditionStatus `json:"ready"`
+	Reason string                 `json:"reason,omitempty"`
+
+	// Values are the resolved values of the current revision. Values read from Secrets are redacted.
+	Values []InventoryValue `json:"values,omitempty"`
+
+	// Objects are the objects of the current revision, dependencies first, with their live health
+	Objects []InventoryObject `json:"objects,omitempty"`
+
+	// Error holds the reason the current revision could not be read, if it couldn't
+	Error string `json:"error,omitempty"`
+}
+
+// InventoryValue is a resolved value of an App
+type InventoryValue struct {
+	TargetIdentifier parsing.TargetIdentifier `json:"targetId"`
+	Value            interface{}              `json:"value,omitempty"`
+
+	// Redacted is true if the value was read from a Secret, and is not shown
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// InventoryObject is an object rendered for an App
+type InventoryObject struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Namespace  string       `json:"namespace,omitempty"`
+	Name       string       `json:"name"`
+	Health     ObjectHealth `json:"health"`
+	Message    string       `json:"message,omitempty"`
+}
+
+// Inventory lists all Apps selected by the filter, with their Cap, the resolved non-secret values and the objects of
+// their current revision, and the health of the live objects. Apps are sorted by namespace and name.
+func (r *AppReconciler) Inventory(ctx context.Context, filter InventoryFilter) (*Inventory, error) {
+	var opts []client.ListOption
+	if filter.Namespace != "" {
+		opts = append(opts, client.InNamespace(filter.Namespace))
+	}
+	if filter.Selector != nil {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: filter.Selector})
+	}
+	var apps shipcapsv1beta1.AppList
+	if err := r.List(ctx, &apps, opts...); err != nil {
+		return nil, fmt.Errorf("unable to list Apps: %w", err)
+	}
+	sort.Slice(apps.Items, func(i, j int) bool {
+		if apps.Items[i].Namespace != apps.Items[j].Namespace {
+			return apps.Items[i].Namespace < apps.Items[j].Namespace
+		}
+		return apps.Items[i].Name < apps.Items[j].Name
+	})
+
+	inventory := Inventory{Apps: []InventoryApp{}}
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		item := InventoryApp{
+			Namespace:   app.Namespace,
+			Name:        app.Name,
+			Labels:      app.Labels,
+			CapRevision: app.Status.CapRevision,
+			CapVersion:  app.Status.CapVersion,
+			Revision:    app.Status.Revision,
+			Ready:       corev1.ConditionUnknown,
+		}
+		switch {
+		case app.Spec.CapRef != nil:
+			item.CapKind, item.Cap = "Cap", app.Spec.CapRef.Namespace+"/"+app.Spec.CapRef.Name
+		case app.Spec.ClusterCapRef != nil:
+			item.CapKind, item.Cap = "ClusterCap", app.Spec.ClusterCapRef.Name
+		}
+		if filter.Cap != "" && filter.Cap != item.Cap {
+			continue
+		}
+		if cond := app.GetCondition(shipcapsv1beta1.AppReady); cond != nil {
+			item.Ready, item.Reason = cond.Status, cond.Reason
+		}
+
+		if err := r.inventoryRevision(ctx, app, &item); err != nil {
+			item.Error = err.Error()
+		}
+		inventory.Apps = append(inventory.Apps, item)
+	}
+	return &inventory, nil
+}
+
+// inventoryRevision adds the values and objects of the App's current revision to the inventory item
+func (r *AppReconciler) inventoryRevision(ctx context.Context, app *shipcapsv1beta1.App, item *InventoryApp) error {
+	if app.Status.Revision == 0 {
+		return fmt.Errorf("no revision recorded yet")
+	}
+	render, err := r.loadRevision(ctx, app, app.Status.Revision)
+	if err != nil {
+		return err
+	}
+
+	secrets := make(map[parsing.TargetIdentifier]bool, len(render.SecretTargets))
+	for _, target := range render.SecretTargets {
+		secrets[target] = true
+	}
+	for _, value := range render.Values {
+		// Revisions that don't record which values are secret show none of them.
+		if render.SecretTargets == nil || secrets[value.TargetIdentifier] {
+			item.Values = append(item.Values, InventoryValue{TargetIdentifier: value.TargetIdentifier, Redacted: true})
+			continue
+		}
+		item.Values = append(item.Values, InventoryValue{TargetIdentifier: value.TargetIdentifier, Value: value.Value})
+	}
+
+	for _, content := range append(render.Dependencies, render.Objects...) {
+		obj := unstructured.Unstructured{Object: content}
+		object := InventoryObject{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		}
+		live := unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		switch err := r.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}, &live); {
+		case apierrors.IsNotFound(err):
+			object.Health = MissingObjectHealth
+		case err != nil:
+			object.Health, object.Message = UnknownObjectHealth, err.Error()
+		default:
+			object.Health, object.Message = objectHealth(&live)
+		}
+		item.Objects = append(item.Objects, object)
+	}
+	if render.SecretTargets == nil && len(render.Values) > 0 {
+		return fmt.Errorf("values are redacted, as the revision doesn't record which of them are secret")
+	}
+	return nil
+}
+
+// secretTargets returns the sorted targetIds of the App's values that are read from Secrets, either by the App or the
+// Cap it is rendered from. Outputs of other Apps count as secret, unless they are published in the App's status. The
+// result is never nil, so revisions tell apart having no secret values from not recording them.
+func (r *AppReconciler) secretTargets(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap) ([]parsing.TargetIdentifier, error) {
+	avs, err := parsing.ParseRawAppValues(parsing.RawAppValues(app.Spec.Values))
+	if err != nil {
+		return nil, err
+	}
+	cvs, err := parsing.ParseRawCapValues(parsing.RawCapValues(cap.Spec.Values))
+	if err != nil {
+		return nil, err
+	}
+
+	secretKeys := make(map[string]bool)
+	for _, av := range avs {
+		switch {
+		case av.ValueFrom != nil && av.ValueFrom.SecretKeyRef != nil:
+			secretKeys[av.Key] = true
+		case av.ValueFromApp != nil:
+			other := shipcapsv1beta1.App{}
+			if err := r.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: av.ValueFromApp.Name}, &other); err != nil {
+				secretKeys[av.Key] = true
+				continue
+			}
+			if _, ok := other.Status.Outputs[av.ValueFromApp.Output]; !ok {
+				secretKeys[av.Key] = true
+			}
+		}
+	}
+
+	targets := make(map[parsing.TargetIdentifier]bool)
+	for _, in := range cap.Spec.Inputs {
+		if secretKeys[in.Key] {
+			targets[in.TargetIdentifier] = true
+		}
+	}
+	for _, cv := range cvs {
+		if cv.ValueFrom != nil && cv.ValueFrom.SecretKeyRef != nil {
+			targets[cv.TargetIdentifier] = true
+		}
+	}
+	sorted := make([]parsing.TargetIdentifier, 0, len(targets))
+	for target := range targets {
+		sorted = append(sorted, target)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted, nil
+}
+
+// objectHealth tells the health of a live object from its status. Workloads are healthy once all replicas are ready,
+// Jobs once they succeeded, and other objects once their Ready or Available condition is true. Objects without any
+// of these are healthy as soon as they exist.
+func objectHealth(obj *unstructured.Unstructured) (ObjectHealth, string) {
+	generation := obj.GetGeneration()
+	if observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); found && observed < generation {
+		return ProgressingObjectHealth, "the latest generation is not observed yet"
+	}
+
+	switch obj.GetKind() {
+	case "Deployment", "ReplicaSet", "StatefulSet", "ReplicationController":
+		return replicasHealth(nestedCount(obj.Object, 1, "spec", "replicas"), nestedCount(obj.Object, 0, "status", "readyReplicas"))
+	case "DaemonSet":
+		return replicasHealth(nestedCount(obj.Object, 0, "status", "desiredNumberScheduled"), nestedCount(obj.Object, 0, "status", "numberReady"))
+	case "Pod":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		switch corev1.PodPhase(phase) {
+		case corev1.PodSucceeded:
+			return HealthyObjectHealth, ""
+		case corev1.PodFailed:
+			return DegradedObjectHealth, "pod failed"
+		}
+	case "PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		switch corev1.PersistentVolumeClaimPhase(phase) {
+		case corev1.ClaimBound:
+			return HealthyObjectHealth, ""
+		case corev1.ClaimLost:
+			return DegradedObjectHealth, "claim lost its volume"
+		default:
+			return ProgressingObjectHealth, "claim is not bound yet"
+		}
+	case "Job":
+		if status, message := conditionStatus(obj, "Failed"); status == corev1.ConditionTrue {
+			return DegradedObjectHealth, message
+		}
+		if status, _ := conditionStatus(obj, "Complete"); status == corev1.ConditionTrue {
+			return HealthyObjectHealth, ""
+		}
+		return ProgressingObjectHealth, "job is not complete yet"
+	case "HelmRelease":
+		status, _, _ := unstructured.NestedString(obj.Object, "status", "releaseStatus")
+		switch status {
+		case "deployed":
+			return HealthyObjectHealth, ""
+		case "failed":
+			return DegradedObjectHealth, "release failed"
+		default:
+			return ProgressingObjectHealth, fmt.Sprintf("release status is '%s'", status)
+		}
+	}
+
+	for _, condition := range []string{"Ready", "Available"} {
+		switch status, message := conditionStatus(obj, condition); status {
+		case corev1.ConditionTrue:
+			return HealthyObjectHealth, ""
+		case corev1.ConditionFalse:
+			return ProgressingObjectHealth, message
+		}
+	}
+	return HealthyObjectHealth, ""
+}
+
+// replicasHealth returns the health of a workload with the given number of desired and ready replicas
+func replicasHealth(desired, ready int64) (ObjectHealth, string) {
+	if ready < desired {
+		return ProgressingObjectHealth, fmt.Sprintf("%d of %d replicas ready", ready, desired)
+	}
+	return HealthyObjectHealth, ""
+}
+
+// conditionStatus returns the status and message of the condition of the given type in the object's status, or ""
+// if it has none
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) (corev1.ConditionStatus, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		message, _ := condition["message"].(string)
+		return corev1.ConditionStatus(status), message
+	}
+	return "", ""
+}
+
+// inventoryCSVHeader are the columns of the CSV export of an inventory
+var inventoryCSVHeader = []string{
+	"namespace", "app", "capKind", "cap", "capRevision", "capVersion", "revision", "ready", "reason", "values",
+	"objectApiVersion", "objectKind", "objectNamespace", "objectName", "health", "message", "error",
+}
+
+// WriteCSV writes the inventory as CSV, with one row per object. Apps without objects get a single row. The values
+// of an App are written as JSON object, with redacted values left out.
+func (inv *Inventory) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(inventoryCSVHeader); err != nil {
+		return err
+	}
+	for _, app := range inv.Apps {
+		values := make(map[parsing.TargetIdentifier]interface{})
+		for _, value := range app.Values {
+			if !value.Redacted {
+				values[value.TargetIdentifier] = value.Value
+			}
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		row := []string{
+			app.Namespace, app.Name, app.CapKind, app.Cap, strconv.FormatInt(app.CapRevision, 10), app.CapVersion,
+			strconv.FormatInt(app.Revision, 10), string(app.Ready), app.Reason, string(data),
+		}
+
+		objects := app.Objects
+		if len(objects) == 0 {
+			objects = []InventoryObject{{}}
+		}
+		for _, obj := range objects {
+			record := append(row[:len(row):len(row)], obj.APIVersion, obj.Kind, obj.Namespace, obj.Name,
+				string(obj.Health), obj.Message, app.Error)
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// InventoryHandler serves the inventory of Apps on GET requests. The query parameters namespace, cap and selector (a
+// label selector) filter the Apps. The inventory is returned as JSON, or as CSV if the query parameter output=csv is
+// given.
+func (r *AppReconciler) InventoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := req.URL.Query()
+		filter := InventoryFilter{Namespace: query.Get("namespace"), Cap: query.Get("cap")}
+		if selector := query.Get("selector"); selector != "" {
+			parsed, err := labels.Parse(selector)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid selector: %s", err), http.StatusBadRequest)
+				return
+			}
+			filter.Selector = parsed
+		}
+
+		inventory, err := r.Inventory(req.Context(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if query.Get("output") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			if err := inventory.WriteCSV(w); err != nil {
+				r.Log.Error(err, "unable to write inventory response")
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(inventory); err != nil {
+			r.Log.Error(err, "unable to write inventory response")
+		}
+	})
+}
+
+// InventoryServer serves the inventory endpoint of an AppReconciler at /inventory. It is meant to be added to the
+// manager.
+type InventoryServer struct {
+	// Addr is the address to listen on
+	Addr string
+
+	// Reconciler lists the inventory
+	Reconciler *AppReconciler
+}
+
+// Start runs the server until the stop channel is closed
+func (s *InventoryServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/inventory", s.Reconciler.InventoryHandler())
+	return serve(s.Addr, "", mux, stop)
+}
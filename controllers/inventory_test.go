@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+func TestInventoryRevisionRedaction(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+
+	values := parsing.CapValues{
+		{TargetIdentifier: "name", Value: "web"},
+		{TargetIdentifier: "password", Value: "secret"},
+	}
+	tests := []struct {
+		name          string
+		secretTargets []parsing.TargetIdentifier
+		want          []InventoryValue
+		wantErr       bool
+	}{
+		{
+			name:          "no secret values",
+			secretTargets: []parsing.TargetIdentifier{},
+			want: []InventoryValue{
+				{TargetIdentifier: "name", Value: "web"},
+				{TargetIdentifier: "password", Value: "secret"},
+			},
+		},
+		{
+			name:          "secret value",
+			secretTargets: []parsing.TargetIdentifier{"password"},
+			want: []InventoryValue{
+				{TargetIdentifier: "name", Value: "web"},
+				{TargetIdentifier: "password", Redacted: true},
+			},
+		},
+		{
+			name: "revision without secret targets",
+			want: []InventoryValue{
+				{TargetIdentifier: "name", Redacted: true},
+				{TargetIdentifier: "password", Redacted: true},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The App's current values are not read from Secrets, which must not matter for the recorded revision.
+			app := &shipcapsv1beta1.App{
+				ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid"},
+				Spec:       shipcapsv1beta1.AppSpec{Values: json.RawMessage(`[{"key":"password","value":"changed"}]`)},
+			}
+			c := fake.NewFakeClientWithScheme(scheme, app)
+			r := &AppReconciler{Client: c, Scheme: scheme}
+			if _, err := r.storeRevision(ctx, app, &AppRender{Values: values, SecretTargets: tt.secretTargets}, 1, "hash"); err != nil {
+				t.Fatal(err)
+			}
+			app.Status.Revision = 1
+
+			item := InventoryApp{}
+			err := r.inventoryRevision(ctx, app, &item)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("inventoryRevision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(item.Values, tt.want) {
+				t.Errorf("inventoryRevision() values = %+v, want %+v", item.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretTargets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+
+	published := &shipcapsv1beta1.App{
+		ObjectMeta: v1.ObjectMeta{Name: "db", Namespace: "default"},
+		Status:     shipcapsv1beta1.AppStatus{Outputs: map[string]string{"host": "db.default"}},
+	}
+	r := &AppReconciler{Client: fake.NewFakeClientWithScheme(scheme, published), Scheme: scheme}
+
+	cap := &shipcapsv1beta1.Cap{Spec: shipcapsv1beta1.CapSpec{
+		Inputs: shipcapsv1beta1.CapInputs{
+			{Key: "name", TargetIdentifier: "name"},
+			{Key: "password", TargetIdentifier: "password"},
+			{Key: "host", TargetIdentifier: "host"},
+			{Key: "user", TargetIdentifier: "user"},
+		},
+		Values: json.RawMessage(`[{"targetId":"token","valueFrom":{"secretKeyRef":{"name":"token","key":"token"}}}]`),
+	}}
+	app := &shipcapsv1beta1.App{
+		ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: shipcapsv1beta1.AppSpec{Values: json.RawMessage(`[
+			{"key":"name","value":"web"},
+			{"key":"password","valueFrom":{"secretKeyRef":{"name":"web","key":"password"}}},
+			{"key":"host","valueFromApp":{"name":"db","output":"host"}},
+			{"key":"user","valueFromApp":{"name":"db","output":"user"}}
+		]`)},
+	}
+
+	got, err := r.secretTargets(context.Background(), app, cap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []parsing.TargetIdentifier{"password", "token", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("secretTargets() = %v, want %v", got, want)
+	}
+}
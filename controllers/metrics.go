@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	helmv1 "github.com/fluxcd/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+var (
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shipcaps_app_render_duration_seconds",
+		Help:    "Time it takes to render an App, by the kind of its Cap.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"cap_kind"})
+
+	renderFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipcaps_app_render_failures_total",
+		Help: "Number of failed App renders, by the kind and name of the Cap and the error code.",
+	}, []string{"cap_kind", "cap_namespace", "cap", "code"})
+
+	inputValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipcaps_cap_input_validation_failures_total",
+		Help: "Number of App values that didn't satisfy the inputs of their Cap, by the kind and name of the Cap.",
+	}, []string{"cap_kind", "cap_namespace", "cap"})
+
+	objectsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipcaps_app_objects_applied_total",
+		Help: "Number of objects created or updated for an App.",
+	}, []string{"namespace", "app"})
+
+	objectsPruned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipcaps_app_objects_pruned_total",
+		Help: "Number of objects deleted for an App, as its render no longer contains them.",
+	}, []string{"namespace", "app"})
+
+	dependencyWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shipcaps_app_dependency_wait_seconds",
+		Help:    "Time an App waited for a CapDep or an output of another App, by the reason it waited for.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"reason"})
+
+	appsDesc = prometheus.NewDesc(
+		"shipcaps_apps",
+		"Number of Apps, by the kind and name of their Cap and their state (ready, not_ready, suspended or unknown).",
+		[]string{"cap_kind", "cap_namespace", "cap", "state"}, nil,
+	)
+
+	helmReleasesDesc = prometheus.NewDesc(
+		"shipcaps_helmreleases",
+		"Number of HelmReleases rendered for Apps, by their release status as reported by the helm-operator.",
+		[]string{"status"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(renderDuration, renderFailures, inputValidationFailures, objectsApplied, objectsPruned, dependencyWait)
+}
+
+// waitingReasons are the reasons of the Ready condition of an App that is waiting for a dependency
+var waitingReasons = map[string]bool{
+	shipcapsv1beta1.AppOutputNotReadyReason:  true,
+	shipcapsv1beta1.OutputNotAvailableReason: true,
+	shipcapsv1beta1.DependencyNotReadyReason: true,
+}
+
+// observeDependencyWait records the time an App waited for a dependency, if the given Ready condition it had before
+// this reconcile was waiting, and the App's Ready condition is no longer.
+func observeDependencyWait(app *shipcapsv1beta1.App, before *shipcapsv1beta1.AppCondition) {
+	if before == nil || before.Status != corev1.ConditionFalse || !waitingReasons[before.Reason] {
+		return
+	}
+	if after := app.GetCondition(shipcapsv1beta1.AppReady); after != nil && after.Reason == before.Reason {
+		return
+	}
+	dependencyWait.WithLabelValues(before.Reason).Observe(time.Since(before.LastTransitionTime.Time).Seconds())
+}
+
+// +kubebuilder:rbac:groups=helm.fluxcd.io,resources=helmreleases,verbs=get;list;watch
+
+// stateCollector reports the number of Apps and HelmReleases by their state, as read from the cache on every scrape
+type stateCollector struct {
+	reader client.Reader
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- appsDesc
+	ch <- helmReleasesDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	var apps shipcapsv1beta1.AppList
+	if err := c.reader.List(ctx, &apps); err == nil {
+		type appKey struct{ kind, namespace, name, state string }
+		counts := make(map[appKey]int)
+		for _, app := range apps.Items {
+			key := appKey{state: appState(&app)}
+			switch {
+			case app.Spec.CapRef != nil:
+				key.kind, key.namespace, key.name = "Cap", app.Spec.CapRef.Namespace, app.Spec.CapRef.Name
+			case app.Spec.ClusterCapRef != nil:
+				key.kind, key.name = "ClusterCap", app.Spec.ClusterCapRef.Name
+			}
+			counts[key]++
+		}
+		for key, count := range counts {
+			ch <- prometheus.MustNewConstMetric(appsDesc, prometheus.GaugeValue, float64(count), key.kind, key.namespace, key.name, key.state)
+		}
+	}
+
+	var releases helmv1.HelmReleaseList
+	if err := c.reader.List(ctx, &releases); err == nil {
+		counts := make(map[string]int)
+		for _, rel := range releases.Items {
+			owner := rel.GetObjectMeta().GetOwnerReferences()
+			if len(owner) == 0 || owner[0].Kind != "App" || owner[0].APIVersion != shipcapsv1beta1.GroupVersion.String() {
+				continue
+			}
+			status := rel.Status.ReleaseStatus
+			if status == "" {
+				status = "unknown"
+			}
+			counts[status]++
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(helmReleasesDesc, prometheus.GaugeValue, float64(count), status)
+		}
+	}
+}
+
+// appState returns the state of an App as reported by the shipcaps_apps metric
+func appState(app *shipcapsv1beta1.App) string {
+	if cond := app.GetCondition(shipcapsv1beta1.AppSuspended); cond != nil && cond.Status == corev1.ConditionTrue {
+		return "suspended"
+	}
+	cond := app.GetCondition(shipcapsv1beta1.AppReady)
+	switch {
+	case cond == nil:
+		return "unknown"
+	case cond.Status == corev1.ConditionTrue:
+		return "ready"
+	default:
+		return "not_ready"
+	}
+}
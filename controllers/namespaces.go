@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// AnyNamespace allows Apps to write into any namespace, when listed in the allowed target namespaces
+const AnyNamespace = "*"
+
+// clusterScopedKinds are the built-in kinds that are not namespaced. They are used to tell whether a rendered object
+// is namespaced, when the reconciler has no RESTMapper or the mapper doesn't know the kind.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Kind: "Namespace"}:        true,
+	{Kind: "Node"}:             true,
+	{Kind: "PersistentVolume"}: true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                       true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:               true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                           true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}: true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                 true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                    true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                             true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                    true,
+	{Group: shipcapsv1beta1.GroupVersion.Group, Kind: "ClusterCap"}:                 true,
+}
+
+// isNamespaced returns true if objects of the given kind are namespaced
+func (r *AppReconciler) isNamespaced(gvk schema.GroupVersionKind) bool {
+	if r.RESTMapper != nil {
+		if mapping, err := r.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			return mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		}
+	}
+	return !clusterScopedKinds[gvk.GroupKind()]
+}
+
+// allowsNamespace returns true if the list contains the namespace, or AnyNamespace
+func allowsNamespace(list []string, namespace string) bool {
+	for _, ns := range list {
+		if ns == AnyNamespace || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNamespace returns an error if the given App may not write into the namespace. Apps may always write into
+// their own namespace. Other namespaces must be allowed by the operator, and by the Cap if it restricts them.
+func (r *AppReconciler) checkNamespace(app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap, namespace, object string) error {
+	if namespace == app.Namespace {
+		return nil
+	}
+	if allowsNamespace(r.AllowedTargetNamespaces, namespace) &&
+		(len(cap.Spec.TargetNamespaces) == 0 || allowsNamespace(cap.Spec.TargetNamespaces, namespace)) {
+		return nil
+	}
+	return errors.NewShipCapsError(errors.NamespaceNotAllowedCode,
+		fmt.Sprintf("app may not write into namespace '%s'", namespace)).
+		With(errors.Context{App: app.AppKey(), Cap: cap.CapKey(), Object: object})
+}
+
+// targetNamespaces renders the namespaced objects that don't specify a namespace into the App's target namespace,
+// and checks that the App may write into the namespaces of all objects, and the target namespace of HelmReleases.
+func (r *AppReconciler) targetNamespaces(app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap, objs []map[string]interface{}) error {
+	target := app.GetTargetNamespace()
+	if err := r.checkNamespace(app, cap, target, ""); err != nil {
+		return err
+	}
+	for _, content := range objs {
+		obj := unstructured.Unstructured{Object: content}
+		gvk := obj.GroupVersionKind()
+		if !r.isNamespaced(gvk) {
+			continue
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(target)
+		}
+		object := fmt.Sprintf("%s %s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName())
+		if err := r.checkNamespace(app, cap, obj.GetNamespace(), object); err != nil {
+			return err
+		}
+		if gvk.Kind == "HelmRelease" {
+			ns, _, _ := unstructured.NestedString(obj.Object, "spec", "targetNamespace")
+			if ns != "" {
+				if err := r.checkNamespace(app, cap, ns, object); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
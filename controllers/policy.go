@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// +kubebuilder:rbac:groups=shipcaps.redradrat.xyz,resources=cappolicies,verbs=get;list;watch
+
+// checkPolicies returns the violations of the given objects of a Cap against all CapPolicies that apply to it
+func checkPolicies(ctx context.Context, c client.Reader, cap *shipcapsv1beta1.Cap, objs []map[string]interface{}) ([]string, error) {
+	var policies shipcapsv1beta1.CapPolicyList
+	if err := c.List(ctx, &policies); err != nil {
+		return nil, fmt.Errorf("unable to list CapPolicies: %w", err)
+	}
+	return shipcapsv1beta1.CheckPolicies(policies.Items, cap, objs), nil
+}
+
+// enforcePolicies returns an error if the given rendered objects of the App violate a CapPolicy
+func (r *AppReconciler) enforcePolicies(ctx context.Context, app *shipcapsv1beta1.App, cap *shipcapsv1beta1.Cap, objs []map[string]interface{}) error {
+	violations, err := checkPolicies(ctx, r.Client, cap, objs)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return errors.NewShipCapsError(errors.PolicyViolationCode, strings.Join(violations, "; ")).
+			With(errors.Context{App: app.AppKey(), Cap: cap.CapKey()})
+	}
+	return nil
+}
+
+// reconcilePolicies records the violations of the Cap's InLine manifests, or of its helmchart source, against the
+// CapPolicies in its status. Manifests read from a repo are only checked once they are rendered for an App.
+func reconcilePolicies(ctx context.Context, c client.Reader, cap *shipcapsv1beta1.Cap) error {
+	manifests, err := cap.Spec.Source.InLineManifests()
+	if err != nil {
+		// An invalid source is reported by the Apps of the Cap.
+		cap.Status.PolicyViolations = nil
+		return nil
+	}
+	violations, err := checkPolicies(ctx, c, cap, manifests)
+	if err != nil {
+		return err
+	}
+	cap.Status.PolicyViolations = violations
+	return nil
+}
+
+// appsForPolicy maps a CapPolicy to all Apps, as it may apply to the Cap of any of them
+func (r *AppReconciler) appsForPolicy() handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		var apps shipcapsv1beta1.AppList
+		if err := r.List(context.Background(), &apps); err != nil {
+			r.Log.Error(err, "unable to list Apps for policy", "policy", obj.Meta.GetName())
+			return nil
+		}
+		reqs := make([]reconcile.Request, 0, len(apps.Items))
+		for _, app := range apps.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name}})
+		}
+		return reqs
+	}
+}
+
+// capsForPolicy maps a CapPolicy to all Caps (or ClusterCaps, if cluster is true), as it may apply to any of them
+func capsForPolicy(c client.Reader, log logr.Logger, cluster bool) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		var reqs []reconcile.Request
+		if cluster {
+			var caps shipcapsv1beta1.ClusterCapList
+			if err := c.List(context.Background(), &caps); err != nil {
+				log.Error(err, "unable to list ClusterCaps for policy", "policy", obj.Meta.GetName())
+				return nil
+			}
+			for _, cap := range caps.Items {
+				reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: cap.Name}})
+			}
+			return reqs
+		}
+		var caps shipcapsv1beta1.CapList
+		if err := c.List(context.Background(), &caps); err != nil {
+			log.Error(err, "unable to list Caps for policy", "policy", obj.Meta.GetName())
+			return nil
+		}
+		for _, cap := range caps.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cap.Namespace, Name: cap.Name}})
+		}
+		return reqs
+	}
+}
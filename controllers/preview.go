@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// PreviewResult holds the objects rendered for an App, and the apiserver's response to applying them in dry-run mode
+type PreviewResult struct {
+	// CapRevision is the revision of the Cap the App was rendered from
+	CapRevision int64 `json:"capRevision,omitempty"`
+
+	// Objects are the rendered objects, dependencies first
+	Objects []PreviewObject `json:"objects"`
+}
+
+// PreviewObject is a single rendered object of a preview
+type PreviewObject struct {
+	// Object is the rendered object
+	Object map[string]interface{} `json:"object"`
+
+	// Error holds the reason the apiserver rejected the object, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// Preview renders the given App just like the reconciler would, and applies every rendered object with server-side
+// apply in dry-run mode, with the identity the reconciler would apply it with. The App doesn't need to exist. Render
+// failures are returned as error, while objects the apiserver rejects are reported in the result.
+func (r *AppReconciler) Preview(ctx context.Context, app *shipcapsv1beta1.App) (*PreviewResult, error) {
+	if app.Name == "" || app.Namespace == "" {
+		return nil, fmt.Errorf("app name and namespace are required")
+	}
+
+	render, err := r.Render(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ServiceAccount is no part of Cap revisions, so the live Cap tells which one the objects are applied as.
+	cap, err := r.getCap(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.applyClient(app, &cap)
+	if err != nil {
+		return nil, err
+	}
+
+	result := PreviewResult{CapRevision: render.CapRevision}
+	// Dependencies are applied with the operator's identity, like the reconciler does.
+	for _, content := range render.Dependencies {
+		result.Objects = append(result.Objects, previewObject(ctx, r.Client, content))
+	}
+	for _, content := range render.Objects {
+		result.Objects = append(result.Objects, previewObject(ctx, c, content))
+	}
+
+	return &result, nil
+}
+
+// previewObject applies the given rendered object in dry-run mode with the given client
+func previewObject(ctx context.Context, c client.Client, content map[string]interface{}) PreviewObject {
+	preview := PreviewObject{Object: content}
+	// Work on a copy, as the apiserver response would replace the rendered content.
+	dryRun := (&unstructured.Unstructured{Object: content}).DeepCopy()
+	if err := c.Patch(ctx, dryRun, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership, client.DryRunAll); err != nil {
+		preview.Error = err.Error()
+	}
+	return preview
+}
+
+// Manifests returns the rendered objects as multi-document YAML. Rejected objects are preceded by a comment holding
+// the apiserver's error.
+func (result *PreviewResult) Manifests() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, obj := range result.Objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		if obj.Error != "" {
+			fmt.Fprintf(&buf, "# error: %s\n", obj.Error)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// PreviewHandler serves previews of Apps. It expects an App as JSON or YAML in the body of a POST request, and
+// responds with a PreviewResult as JSON, or with the manifests as YAML if the query parameter output=yaml is given.
+// Requests need a bearer token of a user that may create the App.
+func (r *AppReconciler) PreviewHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(http.MaxBytesReader(w, req.Body, 1<<20)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		app := shipcapsv1beta1.App{}
+		if err := yaml.Unmarshal(body.Bytes(), &app); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode app: %s", err), http.StatusBadRequest)
+			return
+		}
+		if status, err := r.authorizePreview(req, &app); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		result, err := r.Preview(req.Context(), &app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if req.URL.Query().Get("output") == "yaml" {
+			data, err := result.Manifests()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			r.Log.Error(err, "unable to write preview response")
+		}
+	})
+}
+
+// authorizePreview authenticates the bearer token of the request with a TokenReview, and checks with a
+// SubjectAccessReview that its user may create the App. The preview resolves values with the operator's permissions,
+// so it must not reveal more than creating the App would. Returns the HTTP status to respond with on failure.
+func (r *AppReconciler) authorizePreview(req *http.Request, app *shipcapsv1beta1.App) (int, error) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == req.Header.Get("Authorization") {
+		return http.StatusUnauthorized, fmt.Errorf("a bearer token is required")
+	}
+
+	review := authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := r.Create(req.Context(), &review); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	access := authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: app.Namespace,
+				Verb:      "create",
+				Group:     shipcapsv1beta1.GroupVersion.Group,
+				Resource:  "apps",
+				Name:      app.Name,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if err := r.Create(req.Context(), &access); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to review access: %w", err)
+	}
+	if !access.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("user '%s' may not create app '%s/%s'", user.Username, app.Namespace, app.Name)
+	}
+	return http.StatusOK, nil
+}
+
+// PreviewServer serves the preview endpoint of an AppReconciler at /preview. It is meant to be added to the manager.
+type PreviewServer struct {
+	// Addr is the address to listen on
+	Addr string
+
+	// CertDir is the directory holding the tls.crt and tls.key to serve TLS with. Without it, the server only listens
+	// on loopback addresses, as the bearer tokens of requests would cross the network unencrypted.
+	CertDir string
+
+	// Reconciler renders the previews
+	Reconciler *AppReconciler
+}
+
+// Start runs the server until the stop channel is closed
+func (s *PreviewServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/preview", s.Reconciler.PreviewHandler())
+	if s.CertDir == "" && !isLoopback(s.Addr) {
+		return fmt.Errorf("the preview endpoint serves plain HTTP without a cert dir, so it may only bind to localhost, not '%s'", s.Addr)
+	}
+	return serve(s.Addr, s.CertDir, mux, stop)
+}
+
+// isLoopback returns true if the given address binds to localhost only
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serve serves the handler on the given address until the stop channel is closed. If certDir is set, TLS is served
+// with the tls.crt and tls.key in it.
+func serve(addr, certDir string, handler http.Handler, stop <-chan struct{}) error {
+	server := http.Server{Handler: handler}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		if certDir != "" {
+			errs <- server.ServeTLS(listener, filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+			return
+		}
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case <-stop:
+		return server.Shutdown(context.Background())
+	case err := <-errs:
+		return err
+	}
+}
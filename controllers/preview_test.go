@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "127.0.0.1:8082", want: true},
+		{addr: "localhost:8082", want: true},
+		{addr: "[::1]:8082", want: true},
+		{addr: ":8082"},
+		{addr: "0.0.0.0:8082"},
+		{addr: "10.0.0.1:8082"},
+		{addr: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewServerRequiresTLSBeyondLocalhost(t *testing.T) {
+	s := &PreviewServer{Addr: ":0", Reconciler: &AppReconciler{}}
+	stop := make(chan struct{})
+	close(stop)
+	if err := s.Start(stop); err == nil || !strings.Contains(err.Error(), "localhost") {
+		t.Errorf("Start() = %v, want an error about binding to localhost", err)
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// pruneObjects deletes the objects of the App's current revision that the given render doesn't contain anymore, with
+// the client they were applied with. Only objects still carrying our render hash are deleted, so objects taken over
+// by someone else are left alone. Dependencies are never pruned, as other Apps of the Cap might still use them.
+func (r *AppReconciler) pruneObjects(ctx context.Context, c client.Client, app *shipcapsv1beta1.App, render *AppRender) error {
+	previous := app.Status.Revision
+	if previous == 0 || !hasRevision(app.Status.History, previous) {
+		return nil
+	}
+	old, err := r.loadRevision(ctx, app, previous)
+	if err != nil {
+		return err
+	}
+
+	rendered := make(map[string]bool, len(render.Objects))
+	for _, content := range render.Objects {
+		rendered[objectKey(unstructured.Unstructured{Object: content})] = true
+	}
+	for _, content := range old.Objects {
+		obj := unstructured.Unstructured{Object: content}
+		if rendered[objectKey(obj)] {
+			continue
+		}
+		if err := r.pruneObject(ctx, c, app, obj); err != nil {
+			return errors.Wrap(errors.ApplyFailedCode, err, "unable to prune object").With(errors.Context{
+				App:    app.AppKey(),
+				Object: fmt.Sprintf("%s %s", obj.GetKind(), strings.TrimPrefix(obj.GetNamespace()+"/"+obj.GetName(), "/")),
+			})
+		}
+	}
+	return nil
+}
+
+// pruneObject deletes the live object of the given rendered one, if we applied it
+func (r *AppReconciler) pruneObject(ctx context.Context, c client.Client, app *shipcapsv1beta1.App, obj unstructured.Unstructured) error {
+	live := unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}, &live); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if _, ok := live.GetAnnotations()[RenderHashAnnotation]; !ok {
+		return nil
+	}
+	if err := c.Delete(ctx, &live, client.PropagationPolicy("Background")); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	objectsPruned.WithLabelValues(app.Namespace, app.Name).Inc()
+	r.event(app, corev1.EventTypeNormal, PrunedEventReason, fmt.Sprintf("Pruned %s '%s'", obj.GetKind(), obj.GetName()))
+	return nil
+}
+
+// objectKey identifies a rendered object by its group, kind, namespace and name
+func objectKey(obj unstructured.Unstructured) string {
+	gvk := obj.GroupVersionKind()
+	return fmt.Sprintf("%s/%s/%s/%s", gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName())
+}
+
+// hasRevision returns true if the history lists the given revision
+func hasRevision(history []shipcapsv1beta1.AppRevision, revision int64) bool {
+	for _, rev := range history {
+		if rev.Revision == revision {
+			return true
+		}
+	}
+	return false
+}
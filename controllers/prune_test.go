@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+func TestPruneObjects(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = shipcapsv1beta1.AddToScheme(scheme)
+
+	configMap := func(name string, ours bool) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default"}}
+		if ours {
+			cm.Annotations = map[string]string{RenderHashAnnotation: "hash"}
+		}
+		return cm
+	}
+	rendered := func(names ...string) []map[string]interface{} {
+		var objs []map[string]interface{}
+		for _, name := range names {
+			objs = append(objs, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			})
+		}
+		return objs
+	}
+
+	app := &shipcapsv1beta1.App{ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid"}}
+	c := fake.NewFakeClientWithScheme(scheme, app, configMap("kept", true), configMap("removed", true), configMap("taken-over", false))
+	recorder := record.NewFakeRecorder(10)
+	r := &AppReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+
+	rev, err := r.storeRevision(ctx, app, &AppRender{Objects: rendered("kept", "removed", "taken-over", "gone")}, 1, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Status.Revision = 1
+	app.Status.History = []shipcapsv1beta1.AppRevision{rev}
+
+	if err := r.pruneObjects(ctx, c, app, &AppRender{Objects: rendered("kept")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, exists := range map[string]bool{"kept": true, "removed": false, "taken-over": true} {
+		err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, &corev1.ConfigMap{})
+		if exists && err != nil {
+			t.Errorf("ConfigMap '%s' should exist: %v", name, err)
+		}
+		if !exists && !apierrors.IsNotFound(err) {
+			t.Errorf("ConfigMap '%s' should be pruned, got %v", name, err)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected one event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Normal Pruned Pruned ConfigMap 'removed'" {
+		t.Errorf("unexpected event %q", event)
+	}
+	if pruned := testutil.ToFloat64(objectsPruned.WithLabelValues("default", "web")); pruned != 1 {
+		t.Errorf("expected one pruned object to be counted, got %v", pruned)
+	}
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Defaults of the requeue intervals of the AppReconciler, used when the respective field is not set
+const (
+	DefaultDependencyRequeueDuration = 15 * time.Second
+	DefaultErrorBackoffMin           = 5 * time.Second
+	DefaultErrorBackoffMax           = 5 * time.Minute
+)
+
+// errorBackoffJitter is the maximum fraction of the backoff added as jitter, so Apps failing for the same reason,
+// e.g. an unreachable repo, don't retry in lockstep
+const errorBackoffJitter = 0.2
+
+// backoff tracks the consecutive transient failures of Apps, to compute their exponential requeue delay
+type backoff struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// next records another failure of the given App, and returns the delay to requeue it after. The delay doubles with
+// every consecutive failure, starting at min, and never exceeds max (jitter included).
+func (b *backoff) next(key types.NamespacedName, min, max time.Duration) time.Duration {
+	b.mu.Lock()
+	if b.failures == nil {
+		b.failures = make(map[types.NamespacedName]int)
+	}
+	n := b.failures[key]
+	b.failures[key] = n + 1
+	b.mu.Unlock()
+
+	delay := min
+	for i := 0; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	delay = wait.Jitter(delay, errorBackoffJitter)
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// reset forgets the failures of the given App
+func (b *backoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
+
+// durationOrDefault returns d, or def if d is not set
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
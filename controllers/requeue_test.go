@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestBackoff(t *testing.T) {
+	min, max := time.Second, 10*time.Second
+	key := types.NamespacedName{Namespace: "default", Name: "web"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	b := backoff{}
+
+	// The delay doubles up to max, with up to 20% of jitter added.
+	for i, base := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		base *= time.Second
+		delay := b.next(key, min, max)
+		upper := time.Duration(float64(base) * (1 + errorBackoffJitter))
+		if upper > max {
+			upper = max
+		}
+		if delay < base || delay > upper {
+			t.Errorf("failure %d: delay %s not within [%s, %s]", i+1, delay, base, upper)
+		}
+	}
+
+	if delay := b.next(other, min, max); delay > time.Duration(float64(min)*(1+errorBackoffJitter)) {
+		t.Errorf("failures of other Apps must not count, got delay %s", delay)
+	}
+
+	b.reset(key)
+	if delay := b.next(key, min, max); delay > time.Duration(float64(min)*(1+errorBackoffJitter)) {
+		t.Errorf("delay after reset = %s, want about %s", delay, min)
+	}
+}
+
+func TestDurationOrDefault(t *testing.T) {
+	if got := durationOrDefault(0, time.Minute); got != time.Minute {
+		t.Errorf("durationOrDefault(0) = %s", got)
+	}
+	if got := durationOrDefault(time.Second, time.Minute); got != time.Second {
+		t.Errorf("durationOrDefault(1s) = %s", got)
+	}
+}
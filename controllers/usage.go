@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	shipcapsv1beta1 "github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// accountedResources are the resources summed up in the usage of Apps and Caps
+var accountedResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceStorage}
+
+// addRequests adds the accounted resources of the given requests, multiplied by n, to the usage
+func addRequests(usage corev1.ResourceList, requests corev1.ResourceList, n int64) {
+	for _, name := range accountedResources {
+		q, ok := requests[name]
+		if !ok {
+			continue
+		}
+		sum := usage[name]
+		sum.Add(*resource.NewMilliQuantity(q.MilliValue()*n, q.Format))
+		usage[name] = sum
+	}
+}
+
+// canonical returns the usage with all quantities in their canonical form, as they are read back from the
+// apiserver. Otherwise the status would differ on every reconcile.
+func canonical(usage corev1.ResourceList) corev1.ResourceList {
+	if len(usage) == 0 {
+		return nil
+	}
+	out := make(corev1.ResourceList, len(usage))
+	for name, q := range usage {
+		out[name] = resource.MustParse(q.String())
+	}
+	return out
+}
+
+// containerRequests returns the accounted resources requested by the given container, storage being its ephemeral
+// storage request
+func containerRequests(container corev1.Container) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	addRequests(requests, container.Resources.Requests, 1)
+	if q, ok := container.Resources.Requests[corev1.ResourceEphemeralStorage]; ok {
+		addRequests(requests, corev1.ResourceList{corev1.ResourceStorage: q}, 1)
+	}
+	return requests
+}
+
+// podRequests returns the resources requested by the given pod spec, like the scheduler accounts them: the sum of
+// all containers, or the largest request of an init container if that is higher, as init containers run one by one
+func podRequests(spec corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		addRequests(requests, containerRequests(container), 1)
+	}
+	for _, container := range spec.InitContainers {
+		for name, q := range containerRequests(container) {
+			if current, ok := requests[name]; !ok || q.Cmp(current) > 0 {
+				requests[name] = q
+			}
+		}
+	}
+	return requests
+}
+
+// nestedCount reads a count, like the replicas of a workload, from the object. Returns def if it is not set.
+func nestedCount(obj map[string]interface{}, def int64, fields ...string) int64 {
+	value, found, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !found || err != nil {
+		return def
+	}
+	switch n := value.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	default:
+		return def
+	}
+}
+
+// podTemplateRequests adds the requests of the pod template at the given fields, multiplied by n, to the usage
+func podTemplateRequests(usage corev1.ResourceList, obj map[string]interface{}, n int64, fields ...string) {
+	content, found, err := unstructured.NestedMap(obj, fields...)
+	if !found || err != nil {
+		return
+	}
+	var template corev1.PodTemplateSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &template); err != nil {
+		return
+	}
+	addRequests(usage, podRequests(template.Spec), n)
+}
+
+// renderUsage sums up the CPU, memory and storage requested by the given rendered objects. Workloads count with their
+// replicas (DaemonSets once), Jobs with their parallelism, and PersistentVolumeClaims (including the claim templates
+// of StatefulSets) with their requested storage.
+func renderUsage(objs []map[string]interface{}) corev1.ResourceList {
+	usage := corev1.ResourceList{}
+	for _, obj := range objs {
+		u := unstructured.Unstructured{Object: obj}
+		switch u.GetKind() {
+		case "Pod":
+			var pod corev1.Pod
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &pod); err == nil {
+				addRequests(usage, podRequests(pod.Spec), 1)
+			}
+		case "Deployment", "ReplicaSet", "ReplicationController":
+			podTemplateRequests(usage, obj, nestedCount(obj, 1, "spec", "replicas"), "spec", "template")
+		case "StatefulSet":
+			replicas := nestedCount(obj, 1, "spec", "replicas")
+			podTemplateRequests(usage, obj, replicas, "spec", "template")
+			claims, _, _ := unstructured.NestedSlice(obj, "spec", "volumeClaimTemplates")
+			for _, claim := range claims {
+				if content, ok := claim.(map[string]interface{}); ok {
+					addClaimRequests(usage, content, replicas)
+				}
+			}
+		case "DaemonSet":
+			podTemplateRequests(usage, obj, 1, "spec", "template")
+		case "Job":
+			podTemplateRequests(usage, obj, nestedCount(obj, 1, "spec", "parallelism"), "spec", "template")
+		case "CronJob":
+			podTemplateRequests(usage, obj, nestedCount(obj, 1, "spec", "jobTemplate", "spec", "parallelism"),
+				"spec", "jobTemplate", "spec", "template")
+		case "PersistentVolumeClaim":
+			addClaimRequests(usage, obj, 1)
+		}
+	}
+	return canonical(usage)
+}
+
+// addClaimRequests adds the storage requested by the given PersistentVolumeClaim, multiplied by n, to the usage
+func addClaimRequests(usage corev1.ResourceList, obj map[string]interface{}, n int64) {
+	var claim corev1.PersistentVolumeClaim
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &claim); err != nil {
+		return
+	}
+	if q, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		addRequests(usage, corev1.ResourceList{corev1.ResourceStorage: q}, n)
+	}
+}
+
+// reconcileUsage sums up the usage of all Apps of the given Cap (or ClusterCap, if it has no namespace) in its status
+func reconcileUsage(ctx context.Context, c client.Reader, cap *shipcapsv1beta1.Cap) error {
+	var apps shipcapsv1beta1.AppList
+	if err := c.List(ctx, &apps); err != nil {
+		return err
+	}
+
+	usage := shipcapsv1beta1.CapUsage{}
+	namespaces := make(map[string]*shipcapsv1beta1.NamespaceUsage)
+	for _, app := range apps.Items {
+		if !app.ReferencesCap(cap.Name, cap.Namespace) {
+			continue
+		}
+		ns, ok := namespaces[app.Namespace]
+		if !ok {
+			ns = &shipcapsv1beta1.NamespaceUsage{Namespace: app.Namespace}
+			namespaces[app.Namespace] = ns
+		}
+		usage.Apps++
+		ns.Apps++
+		if usage.Requests == nil {
+			usage.Requests = corev1.ResourceList{}
+		}
+		if ns.Requests == nil {
+			ns.Requests = corev1.ResourceList{}
+		}
+		addRequests(usage.Requests, app.Status.Usage, 1)
+		addRequests(ns.Requests, app.Status.Usage, 1)
+	}
+	usage.Requests = canonical(usage.Requests)
+	if usage.Apps == 0 {
+		cap.Status.Usage = nil
+		return nil
+	}
+
+	for _, ns := range namespaces {
+		ns.Requests = canonical(ns.Requests)
+		usage.Namespaces = append(usage.Namespaces, *ns)
+	}
+	sort.Slice(usage.Namespaces, func(i, j int) bool {
+		return usage.Namespaces[i].Namespace < usage.Namespaces[j].Namespace
+	})
+	cap.Status.Usage = &usage
+	return nil
+}
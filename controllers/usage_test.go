@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestRenderUsage(t *testing.T) {
+	container := func(cpu, memory string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": "app",
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": cpu, "memory": memory},
+			},
+		}
+	}
+	podSpec := func(containers []interface{}, initContainers ...interface{}) map[string]interface{} {
+		spec := map[string]interface{}{"containers": containers}
+		if len(initContainers) > 0 {
+			spec["initContainers"] = initContainers
+		}
+		return spec
+	}
+	workload := func(kind string, replicas interface{}, spec map[string]interface{}) map[string]interface{} {
+		obj := map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "web"},
+			"spec":       map[string]interface{}{"template": map[string]interface{}{"spec": spec}},
+		}
+		if replicas != nil {
+			obj["spec"].(map[string]interface{})["replicas"] = replicas
+		}
+		return obj
+	}
+	claim := func(storage string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "data"},
+			"spec": map[string]interface{}{
+				"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": storage}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		objs []map[string]interface{}
+		want map[corev1.ResourceName]string
+	}{
+		{name: "nothing rendered"},
+		{
+			name: "deployment with replicas",
+			objs: []map[string]interface{}{workload("Deployment", int64(3), podSpec([]interface{}{container("100m", "64Mi")}))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "300m", corev1.ResourceMemory: "192Mi"},
+		},
+		{
+			name: "replicas as float",
+			objs: []map[string]interface{}{workload("Deployment", float64(2), podSpec([]interface{}{container("1", "1Gi")}))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "2", corev1.ResourceMemory: "2Gi"},
+		},
+		{
+			name: "daemonset once",
+			objs: []map[string]interface{}{workload("DaemonSet", int64(5), podSpec([]interface{}{container("100m", "64Mi")}))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "64Mi"},
+		},
+		{
+			name: "containers summed",
+			objs: []map[string]interface{}{workload("Deployment", nil,
+				podSpec([]interface{}{container("100m", "64Mi"), container("200m", "64Mi")}))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "300m", corev1.ResourceMemory: "128Mi"},
+		},
+		{
+			name: "smaller init container",
+			objs: []map[string]interface{}{workload("Deployment", nil,
+				podSpec([]interface{}{container("100m", "64Mi"), container("200m", "64Mi")}, container("250m", "32Mi")))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "300m", corev1.ResourceMemory: "128Mi"},
+		},
+		{
+			name: "larger init container",
+			objs: []map[string]interface{}{workload("Deployment", int64(2),
+				podSpec([]interface{}{container("100m", "64Mi")}, container("500m", "32Mi"), container("200m", "256Mi")))},
+			want: map[corev1.ResourceName]string{corev1.ResourceCPU: "1", corev1.ResourceMemory: "512Mi"},
+		},
+		{
+			name: "claims",
+			objs: []map[string]interface{}{claim("1Gi"), claim("512Mi")},
+			want: map[corev1.ResourceName]string{corev1.ResourceStorage: "1536Mi"},
+		},
+		{
+			name: "helm release",
+			objs: []map[string]interface{}{{"apiVersion": "helm.fluxcd.io/v1", "kind": "HelmRelease", "metadata": map[string]interface{}{"name": "web"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderUsage(tt.objs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("renderUsage() = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if q, ok := got[name]; !ok || q.Cmp(resource.MustParse(want)) != 0 {
+					t.Errorf("renderUsage()[%s] = %s, want %s", name, q.String(), want)
+				}
+			}
+		})
+	}
+}
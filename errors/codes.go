@@ -0,0 +1,101 @@
+package errors
+
+// The catalogue of error codes
+const (
+	// MissingInputCode is used when an App does not set a required input of its Cap
+	MissingInputCode ShipCapsErrorCode = "MissingInput"
+	// TypeMismatchCode is used when a value does not have the type its input or placeholder requires
+	TypeMismatchCode ShipCapsErrorCode = "TypeMismatch"
+	// InvalidValuesCode is used when the values of an App, Cap or CapDep can't be parsed, or reference a Secret,
+	// ConfigMap or key that does not exist
+	InvalidValuesCode ShipCapsErrorCode = "InvalidValues"
+	// ValueResolutionFailedCode is used when a Secret or ConfigMap referenced by a value can't be read for any other
+	// reason
+	ValueResolutionFailedCode ShipCapsErrorCode = "ValueResolutionFailed"
+	// UnresolvedPlaceholderCode is used when a placeholder references no value
+	UnresolvedPlaceholderCode ShipCapsErrorCode = "UnresolvedPlaceholder"
+	// InvalidMaterialSpecCode is used when the source of a Cap or CapDep is invalid
+	InvalidMaterialSpecCode ShipCapsErrorCode = "InvalidMaterialSpec"
+	// SourceFetchFailedCode is used when the repo of a source can't be checked out or read
+	SourceFetchFailedCode ShipCapsErrorCode = "SourceFetchFailed"
+	// RenderFailedCode is used when rendering fails for any other reason
+	RenderFailedCode ShipCapsErrorCode = "RenderFailed"
+	// CapNotFoundCode is used when the Cap or ClusterCap of an App can't be fetched
+	CapNotFoundCode ShipCapsErrorCode = "CapNotFound"
+	// NoMatchingCapVersionCode is used when no revision of a Cap matches the version an App requires
+	NoMatchingCapVersionCode ShipCapsErrorCode = "NoMatchingCapVersion"
+	// CapNotAllowedCode is used when the Cap or ClusterCap of an App may not be used from the App's namespace
+	CapNotAllowedCode ShipCapsErrorCode = "CapNotAllowed"
+	// AppLimitExceededCode is used when a namespace has more Apps of a Cap than the Cap allows
+	AppLimitExceededCode ShipCapsErrorCode = "AppLimitExceeded"
+	// DependencyNotReadyCode is used when a CapDep of a Cap does not exist (yet)
+	DependencyNotReadyCode ShipCapsErrorCode = "DependencyNotReady"
+	// AppOutputNotReadyCode is used when an App consumes an output another App did not publish yet
+	AppOutputNotReadyCode ShipCapsErrorCode = "AppOutputNotReady"
+	// OutputNotAvailableCode is used when an App could not read one of its own outputs yet
+	OutputNotAvailableCode ShipCapsErrorCode = "OutputNotAvailable"
+	// ApplyConflictCode is used when applying an object conflicts with a concurrent change
+	ApplyConflictCode ShipCapsErrorCode = "ApplyConflict"
+	// NamespaceNotAllowedCode is used when an App renders an object into a namespace it may not write into
+	NamespaceNotAllowedCode ShipCapsErrorCode = "NamespaceNotAllowed"
+	// PolicyViolationCode is used when the rendered objects of an App violate a CapPolicy
+	PolicyViolationCode ShipCapsErrorCode = "PolicyViolation"
+	// ApplyForbiddenCode is used when the identity an App is applied with is not allowed to apply an object
+	ApplyForbiddenCode ShipCapsErrorCode = "ApplyForbidden"
+	// ApplyFailedCode is used when the apiserver rejects a rendered object for any other reason
+	ApplyFailedCode ShipCapsErrorCode = "ApplyFailed"
+	// ImpersonationNotSupportedCode is used when a ServiceAccount is named for an App whose objects can't be applied
+	// as one
+	ImpersonationNotSupportedCode ShipCapsErrorCode = "ImpersonationNotSupported"
+)
+
+// codeInfo describes how errors of a code are reported and retried
+type codeInfo struct {
+	reason    string
+	transient bool
+}
+
+var catalogue = map[ShipCapsErrorCode]codeInfo{
+	MissingInputCode:              {reason: "MissingInput"},
+	TypeMismatchCode:              {reason: "TypeMismatch"},
+	InvalidValuesCode:             {reason: "InvalidValues"},
+	ValueResolutionFailedCode:     {reason: "ValueResolutionFailed", transient: true},
+	UnresolvedPlaceholderCode:     {reason: "UnresolvedPlaceholder"},
+	InvalidMaterialSpecCode:       {reason: "InvalidSource"},
+	SourceFetchFailedCode:         {reason: "SourceFetchFailed", transient: true},
+	RenderFailedCode:              {reason: "RenderFailed", transient: true},
+	CapNotFoundCode:               {reason: "CapNotFound", transient: true},
+	CapNotAllowedCode:             {reason: "CapNotAllowed"},
+	AppLimitExceededCode:          {reason: "AppLimitExceeded"},
+	NoMatchingCapVersionCode:      {reason: "NoMatchingCapVersion"},
+	DependencyNotReadyCode:        {reason: "DependencyNotReady", transient: true},
+	AppOutputNotReadyCode:         {reason: "AppOutputNotReady", transient: true},
+	OutputNotAvailableCode:        {reason: "OutputNotAvailable", transient: true},
+	NamespaceNotAllowedCode:       {reason: "NamespaceNotAllowed"},
+	ApplyConflictCode:             {reason: "ApplyConflict", transient: true},
+	PolicyViolationCode:           {reason: "PolicyViolation"},
+	ApplyForbiddenCode:            {reason: "ApplyForbidden", transient: true},
+	ApplyFailedCode:               {reason: "ApplyFailed", transient: true},
+	ImpersonationNotSupportedCode: {reason: "ImpersonationNotSupported"},
+}
+
+// Reason returns the reason of the App status condition for errors of this code
+func (code ShipCapsErrorCode) Reason() string {
+	if info, ok := catalogue[code]; ok {
+		return info.reason
+	}
+	return string(code)
+}
+
+// Transient returns true if errors of this code may resolve by themselves, so the operation should be retried.
+// Terminal errors require a change to the App, Cap or CapDep, which triggers a new attempt anyway.
+func (code ShipCapsErrorCode) Transient() bool {
+	info, ok := catalogue[code]
+	return !ok || info.transient
+}
+
+// IsTransient returns true if err may resolve by itself. Errors without a code are considered transient.
+func IsTransient(err error) bool {
+	code, ok := CodeOf(err)
+	return !ok || code.Transient()
+}
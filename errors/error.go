@@ -1,10 +1,34 @@
 package errors
 
+import (
+	"errors"
+)
+
 type ShipCapsErrorCode string
 
+// Context holds structured information about what an error is about. Empty fields are unknown or irrelevant.
+type Context struct {
+	// App is the namespace/name of the App
+	App string `json:"app,omitempty"`
+
+	// Cap is the namespace/name of the Cap, or the name of the ClusterCap
+	Cap string `json:"cap,omitempty"`
+
+	// Key is the input key
+	Key string `json:"key,omitempty"`
+
+	// Path is the JSON path of the field within a manifest
+	Path string `json:"path,omitempty"`
+
+	// Object is the kind and namespace/name of the object, e.g. a CapDep or an applied object
+	Object string `json:"object,omitempty"`
+}
+
 type ShipCapsError struct {
 	code    ShipCapsErrorCode
 	message string
+	cause   error
+	context Context
 }
 
 // NewShipCapsError returns a new ShipCapsError with a custom message
@@ -15,14 +39,97 @@ func NewShipCapsError(code ShipCapsErrorCode, msg string) ShipCapsError {
 	}
 }
 
+// Wrap returns a new ShipCapsError with the given code, that wraps cause. The message is prepended to the cause's
+// message, and may be empty.
+func Wrap(code ShipCapsErrorCode, cause error, msg string) ShipCapsError {
+	return ShipCapsError{
+		code:    code,
+		message: msg,
+		cause:   cause,
+	}
+}
+
+// With returns a copy of the error, with the non-empty fields of the given context set
+func (err ShipCapsError) With(ctx Context) ShipCapsError {
+	if ctx.App != "" {
+		err.context.App = ctx.App
+	}
+	if ctx.Cap != "" {
+		err.context.Cap = ctx.Cap
+	}
+	if ctx.Key != "" {
+		err.context.Key = ctx.Key
+	}
+	if ctx.Path != "" {
+		err.context.Path = ctx.Path
+	}
+	if ctx.Object != "" {
+		err.context.Object = ctx.Object
+	}
+	return err
+}
+
 func (err ShipCapsError) Error() string {
-	return err.message
+	switch {
+	case err.cause == nil:
+		return err.message
+	case err.message == "":
+		return err.cause.Error()
+	default:
+		return err.message + ": " + err.cause.Error()
+	}
+}
+
+// Code returns the code of the error
+func (err ShipCapsError) Code() ShipCapsErrorCode {
+	return err.code
+}
+
+// Context returns the structured information about what the error is about
+func (err ShipCapsError) Context() Context {
+	return err.context
+}
+
+// Unwrap returns the wrapped cause, if any
+func (err ShipCapsError) Unwrap() error {
+	return err.cause
 }
 
+// Is returns true if target is a ShipCapsError with the same code, so that errors.Is matches errors by code
+func (err ShipCapsError) Is(target error) bool {
+	t, ok := target.(ShipCapsError)
+	return ok && t.code == err.code
+}
+
+// IsErr returns true if err, or any error it wraps, is a ShipCapsError with the given code
 func IsErr(err error, code ShipCapsErrorCode) bool {
-	myerr, ok := err.(ShipCapsError)
-	if !ok {
-		return false
+	return errors.Is(err, ShipCapsError{code: code})
+}
+
+// CodeOf returns the code of the innermost ShipCapsError err wraps (or is), which is the most specific one, as the
+// outer ones are added on the way up. Returns false if there is none.
+func CodeOf(err error) (ShipCapsErrorCode, bool) {
+	var code ShipCapsErrorCode
+	found := false
+	for ; err != nil; err = errors.Unwrap(err) {
+		if scerr, ok := err.(ShipCapsError); ok {
+			code, found = scerr.code, true
+		}
+	}
+	return code, found
+}
+
+// ContextOf returns the context of all ShipCapsErrors err wraps (or is) merged, inner ones taking precedence
+func ContextOf(err error) Context {
+	var errs []ShipCapsError
+	for ; err != nil; err = errors.Unwrap(err) {
+		if scerr, ok := err.(ShipCapsError); ok {
+			errs = append(errs, scerr)
+		}
+	}
+	merged := ShipCapsError{}
+	for _, scerr := range errs {
+		merged = merged.With(scerr.context)
 	}
-	return myerr.code == code
+	return merged.context
 }
@@ -0,0 +1,83 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		code  ShipCapsErrorCode
+		found bool
+	}{
+		{name: "nil", err: nil},
+		{name: "plain error", err: fmt.Errorf("boom")},
+		{name: "shipcaps error", err: NewShipCapsError(MissingInputCode, "missing"), code: MissingInputCode, found: true},
+		{name: "wrapped by fmt", err: fmt.Errorf("outer: %w", NewShipCapsError(TypeMismatchCode, "type")), code: TypeMismatchCode, found: true},
+		{
+			name:  "innermost code wins",
+			err:   Wrap(RenderFailedCode, Wrap(SourceFetchFailedCode, fmt.Errorf("unreachable"), ""), ""),
+			code:  SourceFetchFailedCode,
+			found: true,
+		},
+		{
+			name:  "through plain errors",
+			err:   Wrap(RenderFailedCode, fmt.Errorf("middle: %w", NewShipCapsError(CapNotAllowedCode, "denied")), ""),
+			code:  CapNotAllowedCode,
+			found: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, found := CodeOf(tt.err)
+			if code != tt.code || found != tt.found {
+				t.Errorf("CodeOf() = %q, %v, want %q, %v", code, found, tt.code, tt.found)
+			}
+		})
+	}
+}
+
+func TestIsErr(t *testing.T) {
+	err := Wrap(RenderFailedCode, NewShipCapsError(AppOutputNotReadyCode, "not yet"), "")
+	if !IsErr(err, RenderFailedCode) || !IsErr(err, AppOutputNotReadyCode) {
+		t.Errorf("IsErr() should match all codes of the chain")
+	}
+	if IsErr(err, MissingInputCode) {
+		t.Errorf("IsErr() should not match other codes")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "without code", err: fmt.Errorf("connection refused"), want: true},
+		{name: "terminal", err: NewShipCapsError(MissingInputCode, ""), want: false},
+		{name: "transient", err: NewShipCapsError(SourceFetchFailedCode, ""), want: true},
+		{name: "unknown code", err: NewShipCapsError("Unknown", ""), want: true},
+		{name: "terminal inside transient", err: Wrap(RenderFailedCode, NewShipCapsError(TypeMismatchCode, ""), ""), want: false},
+		{name: "transient inside terminal", err: Wrap(InvalidValuesCode, NewShipCapsError(AppOutputNotReadyCode, ""), ""), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextOf(t *testing.T) {
+	err := Wrap(RenderFailedCode, NewShipCapsError(MissingInputCode, "missing").With(Context{Key: "name", App: "inner"}), "").
+		With(Context{App: "default/web", Cap: "default/web"})
+	want := Context{App: "inner", Cap: "default/web", Key: "name"}
+	if got := ContextOf(err); got != want {
+		t.Errorf("ContextOf() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,379 @@
+// Package gitrepo fetches Cap sources from git repositories
+package gitrepo
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/redradrat/shipcaps/api/v1beta1"
+	"github.com/redradrat/shipcaps/parsing"
+)
+
+const (
+	// DefaultSSHPrivateKeyKey is the default key of the private key in an SSH auth Secret
+	DefaultSSHPrivateKeyKey = "identity"
+	// DefaultSSHKnownHostsKey is the default key of the known_hosts in an SSH auth Secret
+	DefaultSSHKnownHostsKey = "known_hosts"
+)
+
+// Credentials holds the resolved credentials for a git repository
+type Credentials struct {
+	Username string
+	Password string
+
+	SSHPrivateKey []byte
+	SSHKnownHosts []byte
+}
+
+// ResolveCredentials reads the Secrets and ConfigMaps referenced in the given RepoAuth. It returns nil if the RepoAuth
+// does not specify any credentials.
+func ResolveCredentials(auth v1beta1.RepoAuth, resolver parsing.ValueFromResolver) (*Credentials, error) {
+	if auth.SSH != nil && (auth.Username != nil || auth.Password != nil) {
+		return nil, fmt.Errorf("repo auth can either use username/password or ssh, not both")
+	}
+
+	if auth.SSH != nil {
+		keyKey := auth.SSH.PrivateKeyKey
+		if keyKey == "" {
+			keyKey = DefaultSSHPrivateKeyKey
+		}
+		hostsKey := auth.SSH.KnownHostsKey
+		if hostsKey == "" {
+			hostsKey = DefaultSSHKnownHostsKey
+		}
+		key, err := resolveSecretKey(resolver, auth.SSH.SecretName, keyKey)
+		if err != nil {
+			return nil, err
+		}
+		hosts, err := resolveSecretKey(resolver, auth.SSH.SecretName, hostsKey)
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{SSHPrivateKey: []byte(key), SSHKnownHosts: []byte(hosts)}, nil
+	}
+
+	if auth.Username == nil && auth.Password == nil {
+		return nil, nil
+	}
+	if auth.Username == nil || auth.Password == nil {
+		return nil, fmt.Errorf("repo auth requires both username and password")
+	}
+	username, _, err := resolver.ResolveValueFrom(auth.Username)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve repo username: %w", err)
+	}
+	password, _, err := resolver.ResolveValueFrom(auth.Password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve repo password: %w", err)
+	}
+	return &Credentials{Username: username, Password: password}, nil
+}
+
+func resolveSecretKey(resolver parsing.ValueFromResolver, name, key string) (string, error) {
+	src := &v1.EnvVarSource{
+		SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: name},
+			Key:                  key,
+		},
+	}
+	data, _, err := resolver.ResolveValueFrom(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve repo ssh credentials: %w", err)
+	}
+	return data, nil
+}
+
+// authMethod returns the go-git AuthMethod for the given repository URI
+func (c *Credentials) authMethod(uri string) (transport.AuthMethod, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if len(c.SSHPrivateKey) != 0 {
+		ep, err := transport.NewEndpoint(uri)
+		if err != nil {
+			return nil, err
+		}
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		keys, err := ssh.NewPublicKeys(user, c.SSHPrivateKey, "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse repo ssh private key: %w", err)
+		}
+		callback, err := knownHostsCallback(c.SSHKnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		keys.HostKeyCallback = callback
+		return keys, nil
+	}
+
+	return &http.BasicAuth{Username: c.Username, Password: c.Password}, nil
+}
+
+// knownHostsCallback builds a HostKeyCallback from the given known_hosts content. The knownhosts package only reads
+// files, so we hand it a temporary one.
+func knownHostsCallback(knownHosts []byte) (cryptossh.HostKeyCallback, error) {
+	f, err := ioutil.TempFile("", "shipcaps-known-hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(knownHosts); err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse repo ssh known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// DefaultCacheSize is the number of checkouts a Cache keeps if its Size is not set
+const DefaultCacheSize = 32
+
+// Cache keeps checkouts of repositories by URI and commit, so a repo is only cloned again once its ref points to
+// another commit. The remote is still asked for the commit on every checkout, which also checks the credentials. The
+// zero value is ready to use.
+type Cache struct {
+	// Size is the number of checkouts kept. The least recently used one is dropped first. Defaults to
+	// DefaultCacheSize.
+	Size int
+
+	mu        sync.Mutex
+	checkouts map[string]billy.Filesystem
+	used      []string
+}
+
+// Checkout returns the given repository at the given ref (branch, tag or commit), from the cache if possible. The
+// returned filesystem is shared, so it must not be modified.
+func (c *Cache) Checkout(ctx context.Context, spec v1beta1.RepoSpec, creds *Credentials) (billy.Filesystem, error) {
+	auth, err := creds.authMethod(spec.URI)
+	if err != nil {
+		return nil, err
+	}
+	name, hash, err := resolveRef(spec, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	key := spec.URI + "@" + hash.String()
+	if fs := c.get(key); fs != nil {
+		return fs, nil
+	}
+	fs, head, err := clone(ctx, spec, auth, name, hash)
+	if err != nil {
+		return nil, err
+	}
+	// A branch might have moved since we asked the remote, so store the checkout by the commit we actually got.
+	c.put(spec.URI+"@"+head.String(), fs)
+	return fs, nil
+}
+
+func (c *Cache) get(key string) billy.Filesystem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fs, ok := c.checkouts[key]
+	if ok {
+		c.touch(key)
+	}
+	return fs
+}
+
+func (c *Cache) put(key string, fs billy.Filesystem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checkouts == nil {
+		c.checkouts = make(map[string]billy.Filesystem)
+	}
+	c.checkouts[key] = fs
+	c.touch(key)
+
+	size := c.Size
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	for len(c.used) > size {
+		delete(c.checkouts, c.used[0])
+		c.used = c.used[1:]
+	}
+}
+
+// touch marks the key as most recently used
+func (c *Cache) touch(key string) {
+	for i, k := range c.used {
+		if k == key {
+			c.used = append(c.used[:i], c.used[i+1:]...)
+			break
+		}
+	}
+	c.used = append(c.used, key)
+}
+
+// Checkout clones the given repository at the given ref (branch, tag or commit) into memory
+func Checkout(ctx context.Context, spec v1beta1.RepoSpec, creds *Credentials) (billy.Filesystem, error) {
+	auth, err := creds.authMethod(spec.URI)
+	if err != nil {
+		return nil, err
+	}
+	name, hash, err := resolveRef(spec, auth)
+	if err != nil {
+		return nil, err
+	}
+	fs, _, err := clone(ctx, spec, auth, name, hash)
+	return fs, err
+}
+
+// resolveRef asks the remote for the commit the ref of the spec points to. If the ref is a branch or a tag (or empty,
+// for the remote's HEAD), the name of the reference is returned as well. Otherwise the ref has to be a commit.
+func resolveRef(spec v1beta1.RepoSpec, auth transport.AuthMethod) (plumbing.ReferenceName, plumbing.Hash, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{spec.URI}})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", plumbing.ZeroHash, err
+	}
+
+	names := []plumbing.ReferenceName{plumbing.NewBranchReferenceName(spec.Ref), plumbing.NewTagReferenceName(spec.Ref)}
+	if spec.Ref == "" {
+		names = []plumbing.ReferenceName{plumbing.HEAD}
+	}
+	for _, name := range names {
+		for _, ref := range refs {
+			if ref.Name() != name {
+				continue
+			}
+			if ref.Type() == plumbing.SymbolicReference {
+				name = ref.Target()
+				for _, target := range refs {
+					if target.Name() == name {
+						return name, target.Hash(), nil
+					}
+				}
+				return "", plumbing.ZeroHash, fmt.Errorf("remote HEAD points to missing ref '%s'", name)
+			}
+			return name, ref.Hash(), nil
+		}
+	}
+	if spec.Ref == "" {
+		return "", plumbing.ZeroHash, fmt.Errorf("remote has no HEAD")
+	}
+	if !isCommitHash(spec.Ref) {
+		return "", plumbing.ZeroHash, fmt.Errorf("ref '%s' is neither a branch, a tag nor a commit", spec.Ref)
+	}
+	return "", plumbing.NewHash(spec.Ref), nil
+}
+
+// isCommitHash returns true if the ref is a full commit hash
+func isCommitHash(ref string) bool {
+	_, err := hex.DecodeString(ref)
+	return len(ref) == 40 && err == nil
+}
+
+// clone clones the repository into memory. A named reference is cloned shallowly, a commit requires the full
+// history. The commit the checkout is at is returned as well.
+func clone(ctx context.Context, spec v1beta1.RepoSpec, auth transport.AuthMethod, name plumbing.ReferenceName, hash plumbing.Hash) (billy.Filesystem, plumbing.Hash, error) {
+	fs := memfs.New()
+	if name != "" {
+		repo, err := git.CloneContext(ctx, memory.NewStorage(), fs, &git.CloneOptions{
+			URL:           spec.URI,
+			Auth:          auth,
+			ReferenceName: name,
+			SingleBranch:  true,
+			Depth:         1,
+		})
+		if err != nil {
+			return nil, plumbing.ZeroHash, err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return nil, plumbing.ZeroHash, err
+		}
+		return fs, head.Hash(), nil
+	}
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), fs, &git.CloneOptions{URL: spec.URI, Auth: auth})
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("unable to checkout ref '%s': %w", spec.Ref, err)
+	}
+	return fs, hash, nil
+}
+
+// ReadManifests reads all YAML and JSON manifests in the given directory. Multi-document YAML files are supported.
+func ReadManifests(fs billy.Filesystem, dir string) ([]map[string]interface{}, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	files, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read repo path '%s': %w", dir, err)
+	}
+
+	var manifests []map[string]interface{}
+	for _, file := range files {
+		ext := strings.ToLower(path.Ext(file.Name()))
+		if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		f, err := fs.Open(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := decodeManifests(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode manifests in '%s': %w", file.Name(), err)
+		}
+		manifests = append(manifests, decoded...)
+	}
+	return manifests, nil
+}
+
+// decodeManifests decodes all documents in the given YAML or JSON stream, skipping empty ones
+func decodeManifests(r io.Reader) ([]map[string]interface{}, error) {
+	var manifests []map[string]interface{}
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		manifest := make(map[string]interface{})
+		if err := decoder.Decode(&manifest); err != nil {
+			if err == io.EOF {
+				return manifests, nil
+			}
+			return nil, err
+		}
+		if len(manifest) != 0 {
+			manifests = append(manifests, manifest)
+		}
+	}
+}
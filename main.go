@@ -19,6 +19,8 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	helmv1 "github.com/fluxcd/helm-operator/pkg/apis/helm.fluxcd.io/v1"
@@ -53,15 +55,33 @@ func init() {
 func main() {
 	var metricsAddr string
 	var requeueInterval string
+	var clusterCapAuthNamespace string
 	var enableLeaderElection bool
 	var webhooksDisabled bool
+	var previewAddr string
+	var previewCertDir string
+	var inventoryAddr string
+	var catalogAddr string
+	var allowedTargetNamespaces string
+	var dependencyRequeueInterval, errorBackoffMin, errorBackoffMax time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&requeueInterval, "requeue-interval", "1m", "The interval after wich to requeue the app. (see https://godoc.org/time#ParseDuration)")
+	flag.DurationVar(&dependencyRequeueInterval, "dependency-requeue-interval", controllers.DefaultDependencyRequeueDuration, "The interval after which to requeue an app waiting for a CapDep or an output.")
+	flag.DurationVar(&errorBackoffMin, "error-backoff-min", controllers.DefaultErrorBackoffMin, "The initial delay after which to retry an app that failed with a transient error. Doubled with every consecutive failure.")
+	flag.DurationVar(&errorBackoffMax, "error-backoff-max", controllers.DefaultErrorBackoffMax, "The maximum delay after which to retry an app that failed with a transient error.")
+	flag.StringVar(&allowedTargetNamespaces, "allowed-target-namespaces", "", "Comma-separated namespaces Apps may write objects into besides their own, or '*' for any.")
+	flag.StringVar(&clusterCapAuthNamespace, "clustercap-auth-namespace", "shipcaps-system", "The namespace to read repo credentials of ClusterCaps from, and to store their revisions in.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&webhooksDisabled, "disable-webhooks", true,
 		"Disable the webhook registration. (Local dev purposes)")
+	flag.StringVar(&previewAddr, "preview-addr", "", "The address the App preview endpoint binds to, e.g. :8082. Disabled if empty.")
+	flag.StringVar(&previewCertDir, "preview-cert-dir", filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		"The directory holding the tls.crt and tls.key the preview endpoint serves TLS with, by default the webhook server's. "+
+			"If empty, the preview endpoint serves plain HTTP and may only bind to localhost, e.g. 127.0.0.1:8082.")
+	flag.StringVar(&inventoryAddr, "inventory-addr", "", "The address the unauthenticated App inventory endpoint binds to, e.g. 127.0.0.1:8083. Disabled if empty.")
+	flag.StringVar(&catalogAddr, "catalog-addr", "", "The address the unauthenticated Cap catalog endpoint binds to, e.g. 127.0.0.1:8084. Disabled if empty.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -79,18 +99,20 @@ func main() {
 	}
 
 	if err = (&controllers.CapReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Cap"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Cap"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cap-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cap")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.CapDepReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CapDep"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("CapDep"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("capdep-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CapDep")
 		os.Exit(1)
@@ -101,23 +123,54 @@ func main() {
 		setupLog.Error(err, "unable to parse requeue interval", "controller", "App")
 		os.Exit(1)
 	}
-	if err = (&controllers.AppReconciler{
-		Client:          mgr.GetClient(),
-		Log:             ctrl.Log.WithName("controllers").WithName("App"),
-		Scheme:          mgr.GetScheme(),
-		RequeueDuration: parsedInterval,
-	}).SetupWithManager(mgr); err != nil {
+	appReconciler := &controllers.AppReconciler{
+		Client:                    mgr.GetClient(),
+		Log:                       ctrl.Log.WithName("controllers").WithName("App"),
+		Scheme:                    mgr.GetScheme(),
+		RequeueDuration:           parsedInterval,
+		DependencyRequeueDuration: dependencyRequeueInterval,
+		ErrorBackoffMin:           errorBackoffMin,
+		ErrorBackoffMax:           errorBackoffMax,
+		ClusterCapAuthNamespace:   clusterCapAuthNamespace,
+		Recorder:                  mgr.GetEventRecorderFor("app-controller"),
+		Config:                    mgr.GetConfig(),
+		RESTMapper:                mgr.GetRESTMapper(),
+		AllowedTargetNamespaces:   splitList(allowedTargetNamespaces),
+	}
+	if err = appReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "App")
 		os.Exit(1)
 	}
 
+	if previewAddr != "" {
+		if err = mgr.Add(&controllers.PreviewServer{Addr: previewAddr, CertDir: previewCertDir, Reconciler: appReconciler}); err != nil {
+			setupLog.Error(err, "unable to add preview server")
+			os.Exit(1)
+		}
+	}
+	if inventoryAddr != "" {
+		if err = mgr.Add(&controllers.InventoryServer{Addr: inventoryAddr, Reconciler: appReconciler}); err != nil {
+			setupLog.Error(err, "unable to add inventory server")
+			os.Exit(1)
+		}
+	}
+	if catalogAddr != "" {
+		if err = mgr.Add(&controllers.CatalogServer{Addr: catalogAddr, Client: mgr.GetClient(), Log: ctrl.Log.WithName("catalog")}); err != nil {
+			setupLog.Error(err, "unable to add catalog server")
+			os.Exit(1)
+		}
+	}
+
 	if !webhooksDisabled {
 		mgr.GetWebhookServer().Register(webhooks.AppValidatorPath, &webhook.Admission{Handler: &webhooks.AppValidator{Client: mgr.GetClient()}})
+		mgr.GetWebhookServer().Register(webhooks.CapValidatorPath, &webhook.Admission{Handler: &webhooks.CapValidator{Client: mgr.GetClient()}})
 	}
 	if err = (&controllers.ClusterCapReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ClusterCap"),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("ClusterCap"),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("clustercap-controller"),
+		RevisionNamespace: clusterCapAuthNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterCap")
 		os.Exit(1)
@@ -130,3 +183,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,280 @@
+package parsing
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// ValueFromResolver looks up the content a ValueFrom source refers to. The returned bool is false if an optional
+// source could not be found, in which case the value should be treated as not given.
+type ValueFromResolver interface {
+	ResolveValueFrom(src *v1.EnvVarSource) (string, bool, error)
+
+	// ResolveAppOutput looks up an output published by another App. If the App did not publish the output (yet), an
+	// AppOutputNotReadyCode error is returned.
+	ResolveAppOutput(ref *AppOutputRef) (string, error)
+}
+
+const (
+	// AppOutputNotReadyCode identifies errors caused by a referenced App output not being published (yet)
+	AppOutputNotReadyCode = errors.AppOutputNotReadyCode
+	// InvalidValuesCode identifies errors caused by a referenced Secret, ConfigMap or key not existing
+	InvalidValuesCode = errors.InvalidValuesCode
+)
+
+var appGVK = schema.GroupVersionKind{Group: "shipcaps.redradrat.xyz", Version: "v1beta1", Kind: "App"}
+
+// ClientValueFromResolver resolves Secret and ConfigMap key references, and App outputs within a single namespace
+type ClientValueFromResolver struct {
+	Context   context.Context
+	Client    client.Reader
+	Namespace string
+}
+
+// NewClientValueFromResolver returns a ValueFromResolver that reads Secrets, ConfigMaps and Apps in the given namespace
+func NewClientValueFromResolver(ctx context.Context, c client.Reader, namespace string) *ClientValueFromResolver {
+	return &ClientValueFromResolver{
+		Context:   ctx,
+		Client:    c,
+		Namespace: namespace,
+	}
+}
+
+// ResolveValueFrom reads the Secret or ConfigMap key referenced by the given source. The resolved content is never
+// part of any returned error, so it is safe to log those.
+func (r *ClientValueFromResolver) ResolveValueFrom(src *v1.EnvVarSource) (string, bool, error) {
+	switch {
+	case src.SecretKeyRef != nil:
+		ref := src.SecretKeyRef
+		secret := v1.Secret{}
+		if err := r.Client.Get(r.Context, client.ObjectKey{Namespace: r.Namespace, Name: ref.Name}, &secret); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, readError(err, fmt.Sprintf("unable to get secret '%s/%s'", r.Namespace, ref.Name))
+		}
+		data, found := secret.Data[ref.Key]
+		if !found {
+			if isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, errors.NewShipCapsError(InvalidValuesCode, fmt.Sprintf("key '%s' not found in secret '%s/%s'", ref.Key, r.Namespace, ref.Name))
+		}
+		return string(data), true, nil
+	case src.ConfigMapKeyRef != nil:
+		ref := src.ConfigMapKeyRef
+		cm := v1.ConfigMap{}
+		if err := r.Client.Get(r.Context, client.ObjectKey{Namespace: r.Namespace, Name: ref.Name}, &cm); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, readError(err, fmt.Sprintf("unable to get configmap '%s/%s'", r.Namespace, ref.Name))
+		}
+		if data, found := cm.Data[ref.Key]; found {
+			return data, true, nil
+		}
+		if data, found := cm.BinaryData[ref.Key]; found {
+			return string(data), true, nil
+		}
+		if isOptional(ref.Optional) {
+			return "", false, nil
+		}
+		return "", false, errors.NewShipCapsError(InvalidValuesCode, fmt.Sprintf("key '%s' not found in configmap '%s/%s'", ref.Key, r.Namespace, ref.Name))
+	default:
+		return "", false, errors.NewShipCapsError(InvalidValuesCode, "valueFrom only supports secretKeyRef and configMapKeyRef")
+	}
+}
+
+// readError returns the error for a Secret or ConfigMap that could not be read. Missing ones are invalid values, while
+// any other error, e.g. an unavailable apiserver, may resolve by itself and is returned without a code.
+func readError(err error, msg string) error {
+	if apierrors.IsNotFound(err) {
+		return errors.Wrap(InvalidValuesCode, err, msg)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// ResolveAppOutput reads the output from the status of the referenced App, or from its outputs Secret if the output
+// is sensitive.
+func (r *ClientValueFromResolver) ResolveAppOutput(ref *AppOutputRef) (string, error) {
+	// The App is read as unstructured object, as our API package builds upon this one.
+	app := unstructured.Unstructured{}
+	app.SetGroupVersionKind(appGVK)
+	if err := r.Client.Get(r.Context, client.ObjectKey{Namespace: r.Namespace, Name: ref.Name}, &app); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", errors.NewShipCapsError(AppOutputNotReadyCode, fmt.Sprintf("app '%s/%s' does not exist", r.Namespace, ref.Name))
+		}
+		return "", err
+	}
+
+	if out, found, _ := unstructured.NestedString(app.Object, "status", "outputs", ref.Output); found {
+		return out, nil
+	}
+
+	secretName, found, _ := unstructured.NestedString(app.Object, "status", "outputsSecretName")
+	if found && secretName != "" {
+		secret := v1.Secret{}
+		if err := r.Client.Get(r.Context, client.ObjectKey{Namespace: r.Namespace, Name: secretName}, &secret); client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+		if data, found := secret.Data[ref.Output]; found {
+			return string(data), nil
+		}
+	}
+
+	return "", errors.NewShipCapsError(AppOutputNotReadyCode, fmt.Sprintf("app '%s/%s' did not publish output '%s' yet", r.Namespace, ref.Name, ref.Output))
+}
+
+func isOptional(opt *bool) bool {
+	return opt != nil && *opt
+}
+
+// ResolveValueFrom returns a copy of the AppValues with all ValueFrom sources replaced by their content. Values of
+// optional sources that could not be found are dropped.
+func (av AppValues) ResolveValueFrom(resolver ValueFromResolver) (AppValues, error) {
+	var out AppValues
+	for _, v := range av {
+		if v.ValueFromApp != nil {
+			if resolver == nil {
+				return nil, fmt.Errorf("unable to resolve valueFromApp for key '%s': no resolver available", v.Key)
+			}
+			data, err := resolver.ResolveAppOutput(v.ValueFromApp)
+			if err != nil {
+				return nil, fmt.Errorf("unable to resolve valueFromApp for key '%s': %w", v.Key, err)
+			}
+			out = append(out, AppValue{Key: v.Key, Value: data})
+			continue
+		}
+		if v.ValueFrom == nil {
+			out = append(out, v)
+			continue
+		}
+		if resolver == nil {
+			return nil, fmt.Errorf("unable to resolve valueFrom for key '%s': no resolver available", v.Key)
+		}
+		data, found, err := resolver.ResolveValueFrom(v.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve valueFrom for key '%s': %w", v.Key, err)
+		}
+		if !found {
+			continue
+		}
+		out = append(out, AppValue{Key: v.Key, Value: data})
+	}
+	return out, nil
+}
+
+// ResolveValueFrom returns a copy of the CapValues with all ValueFrom sources replaced by their content. Values of
+// optional sources that could not be found are dropped.
+func (cv CapValues) ResolveValueFrom(resolver ValueFromResolver) (CapValues, error) {
+	var out CapValues
+	for _, v := range cv {
+		if v.ValueFrom == nil {
+			out = append(out, v)
+			continue
+		}
+		if resolver == nil {
+			return nil, fmt.Errorf("unable to resolve valueFrom for targetId '%s': no resolver available", v.TargetIdentifier)
+		}
+		data, found, err := resolver.ResolveValueFrom(v.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve valueFrom for targetId '%s': %w", v.TargetIdentifier, err)
+		}
+		if !found {
+			continue
+		}
+		out = append(out, CapValue{TargetIdentifier: v.TargetIdentifier, Value: data})
+	}
+	return out, nil
+}
+
+// ReferencesValueSource returns true if any of the AppValues reads from the named Secret (or ConfigMap, if secret
+// is false)
+func (av AppValues) ReferencesValueSource(name string, secret bool) bool {
+	for _, v := range av {
+		if referencesValueSource(v.ValueFrom, name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferencesApp returns true if any of the AppValues consumes an output of the named App
+func (av AppValues) ReferencesApp(name string) bool {
+	for _, v := range av {
+		if v.ValueFromApp != nil && v.ValueFromApp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferencesValueSource returns true if any of the CapValues reads from the named Secret (or ConfigMap, if secret
+// is false)
+func (cv CapValues) ReferencesValueSource(name string, secret bool) bool {
+	for _, v := range cv {
+		if referencesValueSource(v.ValueFrom, name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func referencesValueSource(src *v1.EnvVarSource, name string, secret bool) bool {
+	if src == nil {
+		return false
+	}
+	if secret {
+		return src.SecretKeyRef != nil && src.SecretKeyRef.Name == name
+	}
+	return src.ConfigMapKeyRef != nil && src.ConfigMapKeyRef.Name == name
+}
+
+// CheckReferences checks that every AppValue sets at most one of value, valueFrom and valueFromApp, and that all
+// references are complete. Nothing is looked up, so referenced Secrets, ConfigMaps and Apps need not exist yet.
+func (av AppValues) CheckReferences() error {
+	for _, v := range av {
+		if v.ValueFrom != nil && v.ValueFromApp != nil {
+			return fmt.Errorf("key '%s' sets both valueFrom and valueFromApp", v.Key)
+		}
+		if v.Value != nil && (v.ValueFrom != nil || v.ValueFromApp != nil) {
+			return fmt.Errorf("key '%s' sets both a value and a reference", v.Key)
+		}
+		if v.ValueFromApp != nil && (v.ValueFromApp.Name == "" || v.ValueFromApp.Output == "") {
+			return fmt.Errorf("valueFromApp of key '%s' needs a name and an output", v.Key)
+		}
+		if v.ValueFrom != nil {
+			if err := CheckValueSource(v.ValueFrom); err != nil {
+				return fmt.Errorf("invalid valueFrom of key '%s': %w", v.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckValueSource checks that the source references exactly one Secret or ConfigMap key
+func CheckValueSource(src *v1.EnvVarSource) error {
+	switch {
+	case src.SecretKeyRef != nil && src.ConfigMapKeyRef != nil:
+		return fmt.Errorf("only one of secretKeyRef and configMapKeyRef may be set")
+	case src.SecretKeyRef != nil:
+		if src.SecretKeyRef.Name == "" || src.SecretKeyRef.Key == "" {
+			return fmt.Errorf("secretKeyRef needs a name and a key")
+		}
+	case src.ConfigMapKeyRef != nil:
+		if src.ConfigMapKeyRef.Name == "" || src.ConfigMapKeyRef.Key == "" {
+			return fmt.Errorf("configMapKeyRef needs a name and a key")
+		}
+	default:
+		return fmt.Errorf("valueFrom only supports secretKeyRef and configMapKeyRef")
+	}
+	return nil
+}
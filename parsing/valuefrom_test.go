@@ -0,0 +1,95 @@
+package parsing
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/redradrat/shipcaps/errors"
+)
+
+// unavailableReader fails every read, like an unreachable apiserver
+type unavailableReader struct{}
+
+func (unavailableReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return apierrors.NewServiceUnavailable("apiserver unavailable")
+}
+
+func (unavailableReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return apierrors.NewServiceUnavailable("apiserver unavailable")
+}
+
+func TestResolveValueFromErrors(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, secret)
+	optional := true
+	secretRef := func(name, key string, opt *bool) *v1.EnvVarSource {
+		return &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: name},
+			Key:                  key,
+			Optional:             opt,
+		}}
+	}
+	configMapRef := func(name, key string) *v1.EnvVarSource {
+		return &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: name},
+			Key:                  key,
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		reader client.Reader
+		src    *v1.EnvVarSource
+		found  bool
+		code   errors.ShipCapsErrorCode
+		coded  bool
+	}{
+		{name: "found", reader: c, src: secretRef("db", "password", nil), found: true},
+		{name: "missing secret", reader: c, src: secretRef("other", "password", nil), code: errors.InvalidValuesCode, coded: true},
+		{name: "missing key", reader: c, src: secretRef("db", "user", nil), code: errors.InvalidValuesCode, coded: true},
+		{name: "missing optional secret", reader: c, src: secretRef("other", "password", &optional)},
+		{name: "missing optional key", reader: c, src: secretRef("db", "user", &optional)},
+		{name: "missing configmap", reader: c, src: configMapRef("config", "key"), code: errors.InvalidValuesCode, coded: true},
+		{name: "unsupported source", reader: c, src: &v1.EnvVarSource{}, code: errors.InvalidValuesCode, coded: true},
+		{name: "unavailable apiserver", reader: unavailableReader{}, src: secretRef("db", "password", nil)},
+		{name: "unavailable apiserver for optional", reader: unavailableReader{}, src: secretRef("db", "password", &optional)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewClientValueFromResolver(context.Background(), tt.reader, "default")
+			_, found, err := resolver.ResolveValueFrom(tt.src)
+			if found != tt.found {
+				t.Errorf("ResolveValueFrom() found = %v, want %v", found, tt.found)
+			}
+			code, coded := errors.CodeOf(err)
+			if code != tt.code || coded != tt.coded {
+				t.Errorf("ResolveValueFrom() error = %v, want code %q", err, tt.code)
+			}
+			if _, ok := tt.reader.(unavailableReader); ok && (err == nil || !apierrors.IsServiceUnavailable(unwrapAll(err))) {
+				t.Errorf("ResolveValueFrom() error = %v, want the apiserver error", err)
+			}
+		})
+	}
+}
+
+func unwrapAll(err error) error {
+	for {
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok || u.Unwrap() == nil {
+			return err
+		}
+		err = u.Unwrap()
+	}
+}
@@ -2,6 +2,8 @@ package parsing
 
 import (
 	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
 )
 
 type AppValues []AppValue
@@ -12,7 +14,10 @@ type TargetIdentifier string
 
 type CapValue struct {
 	// Value holds the actual value.
-	Value interface{} `json:"value"`
+	Value interface{} `json:"value,omitempty"`
+
+	// ValueFrom references a Secret or ConfigMap key that holds the actual value.
+	ValueFrom *v1.EnvVarSource `json:"valueFrom,omitempty"`
 
 	// TransformationIdentifier identifies the replacement placeholder.
 	TargetIdentifier TargetIdentifier `json:"targetId"`
@@ -31,7 +36,22 @@ type AppValue struct {
 	Key string `json:"key"`
 
 	// Value holds the actual value.
-	Value interface{} `json:"value"`
+	Value interface{} `json:"value,omitempty"`
+
+	// ValueFrom references a Secret or ConfigMap key that holds the actual value.
+	ValueFrom *v1.EnvVarSource `json:"valueFrom,omitempty"`
+
+	// ValueFromApp references an output of another App in the same namespace that holds the actual value.
+	ValueFromApp *AppOutputRef `json:"valueFromApp,omitempty"`
+}
+
+// AppOutputRef references an output published by an App
+type AppOutputRef struct {
+	// Name of the App publishing the output
+	Name string `json:"name"`
+
+	// Output is the name of the output
+	Output string `json:"output"`
 }
 
 func (av AppValues) Map() map[string]interface{} {
@@ -27,17 +27,33 @@ func (v *AppValidator) Handle(ctx context.Context, req admission.Request) admiss
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	cap := &v1beta1.Cap{}
-	err = v.decoder.Decode(req, cap)
+	cap, err := app.GetCap(ctx, v.Client)
 	if err != nil {
 		return admission.ValidationResponse(
 			false,
-			fmt.Sprintf("referenced Cap '%s/%s' does not exist", cap.Namespace, cap.Name))
+			fmt.Sprintf("unable to get referenced Cap: %s", err))
 	}
 
-	// Let's check if all required inputs from the Cap are in our App
-	// So let's execute the Value rendering and see whether we get any errors there
-	if _, err := cap.RenderValues(app); err != nil {
+	// The Cap has to allow Apps of this namespace, and must not be at its limit of Apps there
+	if err := cap.CheckConsumer(ctx, v.Client, app); err != nil {
+		return admission.ValidationResponse(
+			false,
+			err.Error())
+	}
+	if err := cap.CheckAppLimit(ctx, v.Client, app); err != nil {
+		return admission.ValidationResponse(
+			false,
+			err.Error())
+	}
+	if err := cap.CheckServiceAccount(app); err != nil {
+		return admission.ValidationResponse(
+			false,
+			err.Error())
+	}
+
+	// Let's check if all required inputs from the Cap are in our App. References to Secrets, ConfigMaps and other Apps
+	// are only checked for completeness, as they might not exist yet. The controller resolves them.
+	if err := cap.ValidateValues(app); err != nil {
 		return admission.ValidationResponse(
 			false,
 			err.Error())
@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/redradrat/shipcaps/api/v1beta1"
+)
+
+// +kubebuilder:webhook:path=/validate-v1beta1-cap,mutating=false,failurePolicy=fail,groups="shipcaps.redradrat.xyz",resources=caps;clustercaps,verbs=create;update,versions=v1beta1,name=vcap.shipcaps.redradrat.xyz
+
+const CapValidatorPath = "/validate-v1beta1-cap"
+
+// CapValidator rejects Caps and ClusterCaps whose InLine manifests or helmchart source violate a CapPolicy, or that name
+// a ServiceAccount they can't be applied as
+type CapValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+func (v *CapValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// ClusterCaps share the Cap schema, and are told apart by having no namespace.
+	cap := &v1beta1.Cap{}
+	if err := v.decoder.Decode(req, cap); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if err := cap.CheckServiceAccount(nil); err != nil {
+		return admission.ValidationResponse(false, err.Error())
+	}
+
+	manifests, err := cap.Spec.Source.InLineManifests()
+	if err != nil {
+		return admission.ValidationResponse(false, fmt.Sprintf("invalid inline manifests: %s", err))
+	}
+
+	var policies v1beta1.CapPolicyList
+	if err := v.Client.List(ctx, &policies); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if violations := v1beta1.CheckPolicies(policies.Items, cap, manifests); len(violations) > 0 {
+		return admission.ValidationResponse(false, strings.Join(violations, "; "))
+	}
+
+	return admission.ValidationResponse(true, "manifests comply with all CapPolicies")
+}
+
+func (v *CapValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}